@@ -26,7 +26,27 @@ var jobAddCmd = &cobra.Command{
 
 Examples:
   qq job add "echo hello world" --queue=default --priority=1
-  qq job add "python /path/to/script.py" --schedule="2025-03-01T10:00:00Z"`,
+  qq job add "python /path/to/script.py" --schedule="2025-03-01T10:00:00Z"
+  qq job add "./cleanup.sh" --in=15m
+  qq job add "./backup.sh" --at="tomorrow 02:00" --tz=Europe/Berlin
+  qq job add "./sync.sh" --timeout=15m
+  qq job add "make test" --workdir=/srv/app --env CI=true --env LOG_LEVEL=debug
+  qq job add "curl -f https://example.com" --max-attempts=5 --backoff=exponential --jitter
+  qq job add "./backup.sh" --unique-key=nightly-backup
+  qq job add "./train.sh" --requires gpu --requires os=linux
+
+With --requires, the job only runs on a worker whose labels (qq worker
+--label) satisfy every requirement: key=value, key!=value, key (the label
+is set) or !key (it isn't).
+
+With --unique-key, the job is not added while another job with the same key
+is still queued, blocked, running or waiting to be retried; the existing
+job's ID is printed instead.
+
+--at accepts RFC3339, a Unix timestamp, a date and time ("2025-03-01 02:00")
+or a time of day ("02:00", "today 17:30", "tomorrow 02:00"). Times without an
+offset are read in --tz (default: the local time zone); a bare time of day is
+its next occurrence.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		if len(args) < 1 {
 			fmt.Println("Error: job command is required")
@@ -39,18 +59,45 @@ Examples:
 		// Get command-line arguments
 		jobCmd := strings.Join(args, " ")
 		queueName, _ := cmd.Flags().GetString("queue")
-		priority, _ := cmd.Flags().GetInt("priority")
-		scheduleStr, _ := cmd.Flags().GetString("schedule")
+		// Without --priority the queue's default priority applies
+		var priority int
+		if cmd.Flags().Changed("priority") {
+			priority, _ = cmd.Flags().GetInt("priority")
+		}
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+		workdir, _ := cmd.Flags().GetString("workdir")
+		uniqueKey, _ := cmd.Flags().GetString("unique-key")
+		requires, _ := cmd.Flags().GetStringArray("requires")
 
-		// Parse scheduled time if provided
-		var scheduledTime *time.Time
-		if scheduleStr != "" {
-			parsed, err := time.Parse(time.RFC3339, scheduleStr)
-			if err != nil {
-				fmt.Printf("Error parsing schedule time: %v\n", err)
+		envFlag, _ := cmd.Flags().GetStringArray("env")
+		env, err := queue.ParseEnvAssignments(envFlag)
+		if err != nil {
+			fmt.Printf("Error parsing --env: %v\n", err)
+			return
+		}
+
+		// Build the retry policy. Jobs are only retried when --max-attempts
+		// allows more than one attempt.
+		var retry *queue.RetryPolicy
+		maxAttempts, _ := cmd.Flags().GetInt("max-attempts")
+		if maxAttempts > 1 {
+			retry = &queue.RetryPolicy{MaxAttempts: maxAttempts}
+			retry.Backoff, _ = cmd.Flags().GetString("backoff")
+			retry.Delay, _ = cmd.Flags().GetDuration("retry-delay")
+			retry.MaxDelay, _ = cmd.Flags().GetDuration("max-retry-delay")
+			retry.Jitter, _ = cmd.Flags().GetBool("jitter")
+			retry.ExitCodes, _ = cmd.Flags().GetIntSlice("retry-exit-codes")
+			if err := retry.Validate(); err != nil {
+				fmt.Printf("Invalid retry policy: %v\n", err)
 				return
 			}
-			scheduledTime = &parsed
+		}
+
+		// Resolve the scheduled time if one was given
+		scheduledTime, err := resolveSchedule(cmd)
+		if err != nil {
+			fmt.Printf("Error parsing schedule time: %v\n", err)
+			return
 		}
 
 		// Get database URL
@@ -81,17 +128,49 @@ Examples:
 		}()
 
 		// Add the job to the queue
-		jobID, err := q.AddJob(ctx, jobCmd, queueName, priority, scheduledTime)
+		result, err := q.AddJobWithOptions(ctx, jobCmd, &queue.JobOptions{
+			Queue:       queueName,
+			Priority:    priority,
+			ScheduledAt: scheduledTime,
+			Timeout:     timeout,
+			Retry:       retry,
+			Env:         env,
+			Workdir:     workdir,
+			UniqueKey:   uniqueKey,
+			Requires:    requires,
+		})
 		if err != nil {
 			fmt.Printf("Failed to add job to queue: %v\n", err)
 			return
 		}
-
-		fmt.Printf("Added job to queue %s with priority %d\n", queueName, priority)
-		fmt.Printf("Job ID: %s\n", jobID)
-		fmt.Printf("Job command: %s\n", jobCmd)
-		if scheduledTime != nil {
-			fmt.Printf("Scheduled for: %s\n", scheduledTime.Format(time.RFC3339))
+		jobID := result.JobID
+
+		if result.Duplicate {
+			fmt.Printf("Job with unique key %q is already queued\n", uniqueKey)
+			fmt.Printf("Job ID: %s\n", jobID)
+		} else {
+			fmt.Printf("Added job to queue %s with priority %d\n", queueName, result.Priority)
+			fmt.Printf("Job ID: %s\n", jobID)
+			fmt.Printf("Job command: %s\n", jobCmd)
+			if scheduledTime != nil {
+				if until := time.Until(*scheduledTime).Round(time.Second); until > 0 {
+					fmt.Printf("Scheduled for: %s (in %s)\n", scheduledTime.Format(time.RFC3339), until)
+				} else {
+					fmt.Printf("Scheduled for: %s (already passed, runs now)\n", scheduledTime.Format(time.RFC3339))
+				}
+			}
+			if timeout > 0 {
+				fmt.Printf("Timeout: %s\n", timeout)
+			}
+			if workdir != "" {
+				fmt.Printf("Working directory: %s\n", workdir)
+			}
+			if retry != nil {
+				fmt.Printf("Max attempts: %d\n", retry.MaxAttempts)
+			}
+			if len(requires) > 0 {
+				fmt.Printf("Requires: %s\n", strings.Join(requires, ", "))
+			}
 		}
 
 		// If follow flag is set, poll for output until the job completes
@@ -104,54 +183,184 @@ Examples:
 			}
 
 			fmt.Println()
-			lastOutputLen := 0
+			followJob(ctx, q, jobIDInt, &chunkPrinter{})
+		}
+	},
+}
+
+// resolveSchedule returns the time given with --schedule, --at or --in, or
+// nil if the job should run right away
+func resolveSchedule(cmd *cobra.Command) (*time.Time, error) {
+	scheduleStr, _ := cmd.Flags().GetString("schedule")
+	at, _ := cmd.Flags().GetString("at")
+	in, _ := cmd.Flags().GetDuration("in")
+	tz, _ := cmd.Flags().GetString("tz")
+
+	given := 0
+	for _, set := range []bool{scheduleStr != "", at != "", in != 0} {
+		if set {
+			given++
+		}
+	}
+	if given > 1 {
+		return nil, fmt.Errorf("use only one of --schedule, --at and --in")
+	}
+
+	switch {
+	case scheduleStr != "":
+		parsed, err := time.Parse(time.RFC3339, scheduleStr)
+		if err != nil {
+			return nil, err
+		}
+		return &parsed, nil
+	case at != "":
+		loc, err := queue.LoadScheduleLocation(tz)
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := queue.ParseScheduleTime(at, loc, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		return &parsed, nil
+	case in < 0:
+		return nil, fmt.Errorf("--in must not be negative")
+	case in > 0:
+		runAt := time.Now().Add(in)
+		return &runAt, nil
+	}
+	return nil, nil
+}
 
-			for {
-				time.Sleep(500 * time.Millisecond)
+// cronAddCmd represents the cron add command
+var cronAddCmd = &cobra.Command{
+	Use:   "add [spec] [command]",
+	Short: "Add a recurring job",
+	Long: `Add a cron schedule that enqueues a command, or applies a pipeline file
+given with -f, every time the spec matches.
 
-				job, err := q.GetJob(ctx, jobIDInt)
-				if err != nil {
-					fmt.Printf("Failed to get job status: %v\n", err)
-					return
-				}
+Specs use the standard 5 fields (minute hour day-of-month month day-of-week)
+or a descriptor like @hourly, @daily or @every 30m, and are evaluated in UTC
+unless they start with CRON_TZ=<zone>. --queue and --priority apply to
+command schedules; pipelines set their own.
 
-				// Print any new output since last check
-				if len(job.Output) > lastOutputLen {
-					fmt.Print(job.Output[lastOutputLen:])
-					lastOutputLen = len(job.Output)
-				}
+Examples:
+  qq cron add "*/15 * * * *" "./sync.sh" --queue=sync
+  qq cron add "CRON_TZ=Europe/Berlin 0 6 * * 1-5" "./report.sh" --name=report
+  qq cron add "@daily" -f nightly.yaml --var env=prod`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		filePath, _ := cmd.Flags().GetString("file")
+		if (len(args) == 2) == (filePath != "") {
+			fmt.Println("Error: give either a command or a pipeline file with -f")
+			os.Exit(1)
+		}
 
-				// Check if the job has reached a terminal state
-				switch job.State {
-				case "completed":
-					os.Exit(job.ExitCode)
-				case "discarded", "cancelled":
-					if lastOutputLen == 0 {
-						fmt.Printf("Job %s failed (state: %s)\n", jobID, job.State)
-					}
+		schedule := &queue.CronSchedule{Spec: args[0]}
+		schedule.Name, _ = cmd.Flags().GetString("name")
+		schedule.Queue, _ = cmd.Flags().GetString("queue")
+		// Without --priority the queue's default priority applies
+		if cmd.Flags().Changed("priority") {
+			schedule.Priority, _ = cmd.Flags().GetInt("priority")
+		}
+
+		if filePath != "" {
+			// Store the pipeline source with its variables, so that it is
+			// rendered the same way on every tick
+			source, err := os.ReadFile(filePath)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			af, err := queue.ParseApplyFile(filePath)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			if schedule.Name == "" {
+				schedule.Name = af.Name
+			}
+			schedule.Pipeline = string(source)
+
+			varFiles, _ := cmd.Flags().GetStringArray("var-file")
+			for _, varFile := range varFiles {
+				vars, err := queue.ParseVarFile(varFile)
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
 					os.Exit(1)
 				}
+				af.SetVars(vars)
+			}
+			varFlag, _ := cmd.Flags().GetStringArray("var")
+			vars, err := queue.ParseVarAssignments(varFlag)
+			if err != nil {
+				fmt.Printf("Error parsing --var: %v\n", err)
+				os.Exit(1)
 			}
+			af.SetVars(vars)
+			schedule.Vars = af.Vars
+		} else {
+			schedule.Command = args[1]
 		}
+
+		ctx := context.Background()
+
+		// Get database URL
+		dbURL := viper.GetString("db_url")
+		if dbURL == "" {
+			fmt.Println("Database URL is required. Use --db-url flag or set it in the config file.")
+			os.Exit(1)
+		}
+
+		// Connect to the database
+		db, err := database.New(ctx, dbURL)
+		if err != nil {
+			fmt.Printf("Failed to connect to the database: %v\n", err)
+			os.Exit(1)
+		}
+		defer db.Close()
+
+		// Initialize the queue client
+		q, err := queue.NewInsertOnlyClient(ctx, db.Pool)
+		if err != nil {
+			fmt.Printf("Failed to initialize the queue: %v\n", err)
+			os.Exit(1)
+		}
+
+		if err := q.AddCronSchedule(ctx, schedule); err != nil {
+			fmt.Printf("Failed to add cron schedule: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Added cron schedule %d\n", schedule.ID)
+		fmt.Printf("Next run: %s\n", schedule.NextRunAt.Format(time.RFC3339))
 	},
 }
 
 // queueAddCmd represents the queue add command
 var queueAddCmd = &cobra.Command{
-	Use:   "add",
+	Use:   "add [name]",
 	Short: "Add a new queue",
-	Long: `Add a new queue to the system. Each queue can have its own workers.
+	Long: `Add a new queue to the system. Workers started with --queue read its
+settings: --max-workers replaces the worker's --concurrency for the queue,
+and --timeout applies to its jobs that set no timeout, unless the worker's
+worker.timeouts configuration has an entry for the queue. --priority is the
+priority of jobs added to the queue without --priority.
+
+Jobs can be added to queues that were never added; they use the worker's
+settings.
 
 Example:
-  qq queue add high_priority --max-workers=10`,
+  qq queue add high_priority --max-workers=10
+  qq queue add ci --timeout=30m --priority=2 --description="CI builds"`,
+	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		if len(args) < 1 {
-			fmt.Println("Error: queue name is required")
-			return
-		}
-
-		queueName := args[0]
-		maxWorkers, _ := cmd.Flags().GetInt("max-workers")
+		queueConfig := &queue.QueueConfig{Name: args[0]}
+		queueConfig.MaxWorkers, _ = cmd.Flags().GetInt("max-workers")
+		queueConfig.DefaultTimeout, _ = cmd.Flags().GetDuration("timeout")
+		queueConfig.DefaultPriority, _ = cmd.Flags().GetInt("priority")
+		queueConfig.Description, _ = cmd.Flags().GetString("description")
+		queueConfig.GlobalLimit, _ = cmd.Flags().GetInt("global-limit")
 
 		ctx := context.Background()
 
@@ -159,35 +368,43 @@ Example:
 		dbURL := viper.GetString("db_url")
 		if dbURL == "" {
 			fmt.Println("Database URL is required. Use --db-url flag or set it in the config file.")
-			return
+			os.Exit(1)
 		}
 
 		// Connect to the database
 		db, err := database.New(ctx, dbURL)
 		if err != nil {
 			fmt.Printf("Failed to connect to the database: %v\n", err)
-			return
+			os.Exit(1)
 		}
 		defer db.Close()
 
-		// Initialize the queue client - will add default queue configs
+		// Initialize the queue client
 		q, err := queue.NewInsertOnlyClient(ctx, db.Pool)
 		if err != nil {
 			fmt.Printf("Failed to initialize the queue: %v\n", err)
-			return
+			os.Exit(1)
 		}
-		defer func() {
-			if err := q.Close(context.Background()); err != nil {
-				fmt.Printf("Failed to close the queue: %v\n", err)
-			}
-		}()
 
-		// Note: River Queue doesn't have a direct API to add a new queue.
-		// You can add jobs to any queue name, and River will create it.
-		// Here we're just printing a message for now.
+		if err := q.AddQueueConfig(ctx, queueConfig); err != nil {
+			fmt.Printf("Failed to add queue: %v\n", err)
+			os.Exit(1)
+		}
 
-		fmt.Printf("Queue created: %s with max workers: %d\n", queueName, maxWorkers)
-		fmt.Println("Note: Queues are automatically created when jobs are added to them")
+		fmt.Printf("Queue created: %s\n", queueConfig.Name)
+		if queueConfig.MaxWorkers > 0 {
+			fmt.Printf("Max workers: %d\n", queueConfig.MaxWorkers)
+		}
+		if queueConfig.DefaultTimeout > 0 {
+			fmt.Printf("Default timeout: %s\n", queueConfig.DefaultTimeout)
+		}
+		if queueConfig.DefaultPriority > 0 {
+			fmt.Printf("Default priority: %d\n", queueConfig.DefaultPriority)
+		}
+		if queueConfig.GlobalLimit > 0 {
+			fmt.Printf("Global limit: %d running jobs across all workers\n", queueConfig.GlobalLimit)
+		}
+		fmt.Println("Restart workers processing the queue to apply its settings")
 	},
 }
 
@@ -198,12 +415,41 @@ func init() {
 	// Add queueAddCmd to the queue command
 	queueCmd.AddCommand(queueAddCmd)
 
+	// Add cronAddCmd to the cron command
+	cronCmd.AddCommand(cronAddCmd)
+
 	// Add flags for job add command
 	jobAddCmd.Flags().StringP("queue", "q", "default", "Queue to add the job to")
-	jobAddCmd.Flags().IntP("priority", "p", 1, "Job priority (lower numbers run first)")
+	jobAddCmd.Flags().IntP("priority", "p", 1, "Job priority (lower numbers run first; default: the queue's default priority, else 1)")
 	jobAddCmd.Flags().StringP("schedule", "s", "", "Time to schedule the job (ISO 8601 format)")
+	jobAddCmd.Flags().String("at", "", "Time to run the job, e.g. \"tomorrow 02:00\" or a Unix timestamp")
+	jobAddCmd.Flags().Duration("in", 0, "Run the job after this delay (e.g. 90s, 15m, 2h)")
+	jobAddCmd.Flags().String("tz", "", "Time zone for --at (default: local time zone)")
 	jobAddCmd.Flags().BoolP("follow", "f", false, "Follow job output until completion")
+	jobAddCmd.Flags().Duration("timeout", 0, "Kill the job if it runs longer than this (e.g. 30s, 15m, 2h)")
+	jobAddCmd.Flags().StringArrayP("env", "e", nil, "Environment variable for the job as KEY=VALUE (can be repeated)")
+	jobAddCmd.Flags().String("workdir", "", "Directory to run the job in (default: the worker's working directory)")
+	jobAddCmd.Flags().StringArray("requires", nil, "Label the worker running the job must have, e.g. os=linux, gpu or disk!=hdd (repeatable)")
+	jobAddCmd.Flags().String("unique-key", "", "Don't add the job while an unfinished job with this key exists")
+	jobAddCmd.Flags().Int("max-attempts", 1, "Total attempts before a failing job is given up on (1 = no retries)")
+	jobAddCmd.Flags().String("backoff", queue.BackoffExponential, "Retry backoff strategy (fixed, exponential)")
+	jobAddCmd.Flags().Duration("retry-delay", 0, "Delay before the first retry (default 10s)")
+	jobAddCmd.Flags().Duration("max-retry-delay", 0, "Upper bound for exponential backoff (default 24h)")
+	jobAddCmd.Flags().Bool("jitter", false, "Randomize retry delays")
+	jobAddCmd.Flags().IntSlice("retry-exit-codes", nil, "Exit codes that trigger a retry (default: any non-zero exit code)")
+
+	// Add flags for cron add command
+	cronAddCmd.Flags().StringP("file", "f", "", "Pipeline YAML file to apply on every tick instead of a command")
+	cronAddCmd.Flags().String("name", "", "Name of the schedule (default: the pipeline's name)")
+	cronAddCmd.Flags().StringP("queue", "q", "default", "Queue to add the command's jobs to")
+	cronAddCmd.Flags().IntP("priority", "p", 1, "Priority of the command's jobs (lower numbers run first; default: the queue's default priority, else 1)")
+	cronAddCmd.Flags().StringArray("var", nil, "Set a pipeline variable as key=value (can be repeated)")
+	cronAddCmd.Flags().StringArray("var-file", nil, "YAML file of pipeline variables (can be repeated)")
 
 	// Add flags for queue add command
-	queueAddCmd.Flags().IntP("max-workers", "m", 5, "Maximum number of workers for this queue")
+	queueAddCmd.Flags().IntP("max-workers", "m", 0, "Jobs a worker runs at once from this queue (default: the worker's --concurrency)")
+	queueAddCmd.Flags().Duration("timeout", 0, "Timeout for the queue's jobs that set none (e.g. 30m)")
+	queueAddCmd.Flags().IntP("priority", "p", 0, "Priority of jobs added to the queue without --priority (1-4)")
+	queueAddCmd.Flags().String("description", "", "What the queue is for")
+	queueAddCmd.Flags().Int("global-limit", 0, "Jobs of the queue running at once across all workers (default: no limit)")
 }
@@ -0,0 +1,504 @@
+/*
+Copyright © 2025 Will Atlas <will@atls.dev>
+*/
+package cmd
+
+import (
+	"context"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"qq/pkg/queue"
+)
+
+// openAPISpec describes the /api/v1 endpoints, for generating clients
+//
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+// Limits of the API's list endpoints and request bodies
+const (
+	apiDefaultJobLimit = 100
+	apiMaxJobLimit     = 1000
+	apiMaxBodyBytes    = 1 << 20
+)
+
+// apiJobStatuses are the statuses jobs can be filtered by, as in
+// "qq job ls --status"
+var apiJobStatuses = map[string]bool{
+	"pending":   true,
+	"blocked":   true,
+	"running":   true,
+	"completed": true,
+	"failed":    true,
+}
+
+// apiJob is a job as returned by the API. Output and Attempts are only set
+// when a single job is requested.
+type apiJob struct {
+	ID          int64        `json:"id"`
+	Queue       string       `json:"queue"`
+	Status      string       `json:"status"`
+	State       string       `json:"state"`
+	Command     string       `json:"command"`
+	Attempt     int          `json:"attempt"`
+	ExitCode    int          `json:"exit_code"`
+	Reason      string       `json:"reason,omitempty"`
+	Requires    []string     `json:"requires,omitempty"`
+	Unroutable  bool         `json:"unroutable,omitempty"`
+	CreatedAt   time.Time    `json:"created_at"`
+	ScheduledAt time.Time    `json:"scheduled_at"`
+	Output      *string      `json:"output,omitempty"`
+	Attempts    []apiAttempt `json:"attempts,omitempty"`
+}
+
+// apiAttempt is the recorded result of one attempt of a job
+type apiAttempt struct {
+	Attempt   int       `json:"attempt"`
+	ExitCode  int       `json:"exit_code"`
+	Reason    string    `json:"reason,omitempty"`
+	Output    string    `json:"output"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// apiJobRequest is the body of a job submission, with the options of
+// "qq job add"
+type apiJobRequest struct {
+	Command        string            `json:"command"`
+	Queue          string            `json:"queue"`
+	Priority       int               `json:"priority"`
+	ScheduledAt    *time.Time        `json:"scheduled_at"`
+	TimeoutSeconds int               `json:"timeout_seconds"`
+	Retry          *apiRetryPolicy   `json:"retry"`
+	Env            map[string]string `json:"env"`
+	Workdir        string            `json:"workdir"`
+	UniqueKey      string            `json:"unique_key"`
+	Requires       []string          `json:"requires"`
+}
+
+// apiRetryPolicy is a job's retry policy, with delays in seconds
+type apiRetryPolicy struct {
+	MaxAttempts     int     `json:"max_attempts"`
+	Backoff         string  `json:"backoff"`
+	DelaySeconds    float64 `json:"delay_seconds"`
+	MaxDelaySeconds float64 `json:"max_delay_seconds"`
+	Jitter          bool    `json:"jitter"`
+	ExitCodes       []int   `json:"exit_codes"`
+}
+
+// apiQueue is a queue's statistics and settings
+type apiQueue struct {
+	Name        string `json:"name"`
+	Paused      bool   `json:"paused"`
+	Pending     int    `json:"pending"`
+	Blocked     int    `json:"blocked"`
+	Running     int    `json:"running"`
+	Completed   int    `json:"completed"`
+	Failed      int    `json:"failed"`
+	Configured  bool   `json:"configured"`
+	MaxWorkers  int    `json:"max_workers"`
+	Description string `json:"description,omitempty"`
+	GlobalLimit int    `json:"global_limit"`
+	LimitUsed   int    `json:"limit_used"`
+}
+
+// apiWorker is a worker process, as last reported by its heartbeat
+type apiWorker struct {
+	ID            string                  `json:"id"`
+	Hostname      string                  `json:"hostname"`
+	PID           int                     `json:"pid"`
+	Version       string                  `json:"version"`
+	Labels        map[string]string       `json:"labels"`
+	Queues        []queue.WorkerQueueInfo `json:"queues"`
+	RunningJobIDs []int64                 `json:"running_job_ids"`
+	JobsCompleted int64                   `json:"jobs_completed"`
+	StartedAt     time.Time               `json:"started_at"`
+	HeartbeatAt   time.Time               `json:"heartbeat_at"`
+	Lost          bool                    `json:"lost"`
+	Draining      bool                    `json:"draining"`
+}
+
+// apiPipelineJob is a job inserted by applying a pipeline
+type apiPipelineJob struct {
+	Name     string `json:"name"`
+	ID       int64  `json:"id"`
+	Queue    string `json:"queue"`
+	Existing bool   `json:"existing"`
+}
+
+// newAPIHandler serves the /api/v1 JSON API. Every endpoint but the OpenAPI
+// document requires the API key as a bearer token.
+func newAPIHandler(ctx context.Context, q *queue.QueueClient, apiKey string) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /api/v1/openapi.yaml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Write(openAPISpec)
+	})
+
+	api := http.NewServeMux()
+	mux.Handle("/api/v1/", requireAPIKey(apiKey, api))
+
+	// Submit a job: POST /api/v1/jobs
+	api.HandleFunc("POST /api/v1/jobs", func(w http.ResponseWriter, r *http.Request) {
+		var req apiJobRequest
+		if err := decodeJSON(w, r, &req); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+		opts, err := req.jobOptions()
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		result, err := q.AddJobWithOptions(ctx, req.Command, opts)
+		if err != nil {
+			writeAPIError(w, apiErrorStatus(err), err)
+			return
+		}
+		id, _ := strconv.ParseInt(result.JobID, 10, 64)
+
+		// A duplicate of an unfinished job with the same unique key
+		// returns that job instead of creating one
+		status := http.StatusCreated
+		if result.Duplicate {
+			status = http.StatusOK
+		}
+		writeJSON(w, status, map[string]any{
+			"id":        id,
+			"priority":  result.Priority,
+			"duplicate": result.Duplicate,
+		})
+	})
+
+	// List jobs: GET /api/v1/jobs?queue=&status=&limit=
+	api.HandleFunc("GET /api/v1/jobs", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		status := query.Get("status")
+		if status != "" && !apiJobStatuses[status] {
+			writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid status %q (must be pending, blocked, running, completed or failed)", status))
+			return
+		}
+		limit := apiDefaultJobLimit
+		if s := query.Get("limit"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 1 || n > apiMaxJobLimit {
+				writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid limit %q (must be between 1 and %d)", s, apiMaxJobLimit))
+				return
+			}
+			limit = n
+		}
+
+		jobs, err := q.ListJobs(ctx, query.Get("queue"), status, limit)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err)
+			return
+		}
+		result := make([]apiJob, len(jobs))
+		for i, job := range jobs {
+			result[i] = newAPIJob(job)
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"jobs": result})
+	})
+
+	// Get a job with its output and attempts: GET /api/v1/jobs/{id}
+	api.HandleFunc("GET /api/v1/jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		jobID, ok := apiJobID(w, r)
+		if !ok {
+			return
+		}
+		job, err := q.GetJob(ctx, jobID)
+		if err != nil {
+			writeAPIError(w, apiErrorStatus(err), err)
+			return
+		}
+		attempts, err := q.GetJobAttempts(ctx, jobID)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		result := newAPIJob(*job)
+		result.Output = &job.Output
+		for _, a := range attempts {
+			result.Attempts = append(result.Attempts, apiAttempt{
+				Attempt:   a.Attempt,
+				ExitCode:  a.ExitCode,
+				Reason:    a.Reason,
+				Output:    a.Output,
+				CreatedAt: a.CreatedAt,
+			})
+		}
+		writeJSON(w, http.StatusOK, result)
+	})
+
+	// Cancel a job: POST /api/v1/jobs/{id}/cancel?force=true
+	api.HandleFunc("POST /api/v1/jobs/{id}/cancel", func(w http.ResponseWriter, r *http.Request) {
+		jobID, ok := apiJobID(w, r)
+		if !ok {
+			return
+		}
+		force, _ := strconv.ParseBool(r.URL.Query().Get("force"))
+		if err := q.RemoveJob(ctx, strconv.FormatInt(jobID, 10), force); err != nil {
+			writeAPIError(w, apiErrorStatus(err), err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"id": jobID, "cancelled": true})
+	})
+
+	// Retry a finished job: POST /api/v1/jobs/{id}/retry
+	api.HandleFunc("POST /api/v1/jobs/{id}/retry", func(w http.ResponseWriter, r *http.Request) {
+		jobID, ok := apiJobID(w, r)
+		if !ok {
+			return
+		}
+		if err := q.RetryJob(ctx, jobID); err != nil {
+			writeAPIError(w, apiErrorStatus(err), err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"id": jobID, "retried": true})
+	})
+
+	// Apply pipeline YAML: POST /api/v1/pipelines?var=key=value&run_key=
+	api.HandleFunc("POST /api/v1/pipelines", func(w http.ResponseWriter, r *http.Request) {
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, apiMaxBodyBytes))
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, fmt.Errorf("failed to read request body: %w", err))
+			return
+		}
+		af, err := queue.ParseApplyFileBytes(data)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+		vars, err := queue.ParseVarAssignments(r.URL.Query()["var"])
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+		af.SetVars(vars)
+		if runKey := r.URL.Query().Get("run_key"); runKey != "" {
+			af.RunKey = runKey
+		}
+
+		results, err := q.Apply(ctx, af)
+		if err != nil {
+			writeAPIError(w, apiErrorStatus(err), err)
+			return
+		}
+
+		// Applying with the run key of an unfinished run returns that run
+		status := http.StatusCreated
+		var runID int64
+		jobs := make([]apiPipelineJob, len(results))
+		for i, res := range results {
+			runID = res.RunID
+			if res.Existing {
+				status = http.StatusOK
+			}
+			jobs[i] = apiPipelineJob{Name: res.Name, ID: res.JobID, Queue: res.Queue, Existing: res.Existing}
+		}
+		writeJSON(w, status, map[string]any{"run_id": runID, "jobs": jobs})
+	})
+
+	// Queue stats: GET /api/v1/queues and GET /api/v1/queues/{name}
+	api.HandleFunc("GET /api/v1/queues", func(w http.ResponseWriter, r *http.Request) {
+		stats, err := q.GetQueueStats(ctx, "")
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err)
+			return
+		}
+		queues := make([]apiQueue, len(stats))
+		for i, s := range stats {
+			queues[i] = newAPIQueue(s)
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"queues": queues})
+	})
+
+	api.HandleFunc("GET /api/v1/queues/{name}", func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		stats, err := q.GetQueueStats(ctx, name)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if len(stats) == 0 {
+			writeAPIError(w, http.StatusNotFound, fmt.Errorf("queue %q not found", name))
+			return
+		}
+		writeJSON(w, http.StatusOK, newAPIQueue(stats[0]))
+	})
+
+	// Workers: GET /api/v1/workers
+	api.HandleFunc("GET /api/v1/workers", func(w http.ResponseWriter, r *http.Request) {
+		workers, err := q.ListWorkers(ctx)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err)
+			return
+		}
+		result := make([]apiWorker, len(workers))
+		for i, wk := range workers {
+			result[i] = apiWorker{
+				ID:            wk.ID,
+				Hostname:      wk.Hostname,
+				PID:           wk.PID,
+				Version:       wk.Version,
+				Labels:        wk.Labels,
+				Queues:        wk.Queues,
+				RunningJobIDs: wk.RunningJobIDs,
+				JobsCompleted: wk.JobsCompleted,
+				StartedAt:     wk.StartedAt,
+				HeartbeatAt:   wk.HeartbeatAt,
+				Lost:          wk.Lost,
+				Draining:      wk.Draining,
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"workers": result})
+	})
+
+	api.HandleFunc("/api/v1/", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, http.StatusNotFound, fmt.Errorf("no such endpoint: %s %s", r.Method, r.URL.Path))
+	})
+
+	return mux
+}
+
+// requireAPIKey rejects requests that don't carry the API key as a bearer
+// token
+func requireAPIKey(apiKey string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(apiKey)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="qq"`)
+			writeAPIError(w, http.StatusUnauthorized, errors.New("missing or invalid API key"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// jobOptions validates a job submission and converts it to the options of
+// AddJobWithOptions
+func (req *apiJobRequest) jobOptions() (*queue.JobOptions, error) {
+	if strings.TrimSpace(req.Command) == "" {
+		return nil, errors.New("command is required")
+	}
+	if req.Priority < 0 || req.Priority > 4 {
+		return nil, errors.New("priority must be between 1 and 4")
+	}
+	if req.TimeoutSeconds < 0 {
+		return nil, errors.New("timeout_seconds must not be negative")
+	}
+
+	opts := &queue.JobOptions{
+		Queue:       req.Queue,
+		Priority:    req.Priority,
+		ScheduledAt: req.ScheduledAt,
+		Timeout:     time.Duration(req.TimeoutSeconds) * time.Second,
+		Env:         req.Env,
+		Workdir:     req.Workdir,
+		UniqueKey:   req.UniqueKey,
+		Requires:    req.Requires,
+	}
+	if req.Retry != nil {
+		opts.Retry = &queue.RetryPolicy{
+			MaxAttempts: req.Retry.MaxAttempts,
+			Backoff:     req.Retry.Backoff,
+			Delay:       time.Duration(req.Retry.DelaySeconds * float64(time.Second)),
+			MaxDelay:    time.Duration(req.Retry.MaxDelaySeconds * float64(time.Second)),
+			Jitter:      req.Retry.Jitter,
+			ExitCodes:   req.Retry.ExitCodes,
+		}
+	}
+	return opts, nil
+}
+
+func newAPIJob(job queue.JobInfo) apiJob {
+	return apiJob{
+		ID:          job.ID,
+		Queue:       job.Queue,
+		Status:      mapJobStatus(job.State, job.Reason),
+		State:       job.State,
+		Command:     job.Command,
+		Attempt:     job.Attempt,
+		ExitCode:    job.ExitCode,
+		Reason:      job.Reason,
+		Requires:    job.Requires,
+		Unroutable:  job.Unroutable,
+		CreatedAt:   job.CreatedAt,
+		ScheduledAt: job.ScheduledAt,
+	}
+}
+
+func newAPIQueue(s queue.QueueStats) apiQueue {
+	return apiQueue{
+		Name:        s.Name,
+		Paused:      s.Paused,
+		Pending:     s.Pending,
+		Blocked:     s.Blocked,
+		Running:     s.Running,
+		Completed:   s.Completed,
+		Failed:      s.Failed,
+		Configured:  s.Configured,
+		MaxWorkers:  s.MaxWorkers,
+		Description: s.Description,
+		GlobalLimit: s.GlobalLimit,
+		LimitUsed:   s.LimitUsed,
+	}
+}
+
+// apiJobID parses the job ID of the request path, replying with an error if
+// it is invalid
+func apiJobID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	jobID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid job ID %q", r.PathValue("id")))
+		return 0, false
+	}
+	return jobID, true
+}
+
+// apiErrorStatus maps the errors of QueueClient methods to HTTP statuses
+func apiErrorStatus(err error) int {
+	var validationErr *queue.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		return http.StatusBadRequest
+	case errors.Is(err, queue.ErrJobNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, queue.ErrJobFinished), errors.Is(err, queue.ErrJobRunning), errors.Is(err, queue.ErrJobNotFinished):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// decodeJSON reads a JSON request body into v, rejecting unknown fields so
+// that typos don't go unnoticed
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, apiMaxBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
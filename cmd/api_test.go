@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"qq/pkg/queue"
+)
+
+func apiRequest(t *testing.T, method, path, key, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	// Only requests rejected before reaching the database are sent, so no
+	// queue client is needed
+	handler := newAPIHandler(context.Background(), nil, "secret")
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAPIRequiresKey(t *testing.T) {
+	rec := apiRequest(t, "GET", "/api/v1/jobs", "", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.JSONEq(t, `{"error": "missing or invalid API key"}`, rec.Body.String())
+
+	rec = apiRequest(t, "GET", "/api/v1/jobs", "wrong", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	// The OpenAPI document is public
+	rec = apiRequest(t, "GET", "/api/v1/openapi.yaml", "", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestAPIRejectsInvalidRequests(t *testing.T) {
+	tests := []struct {
+		method, path, body string
+		status             int
+	}{
+		{"POST", "/api/v1/jobs", `{"queue": "ci"}`, http.StatusBadRequest},
+		{"POST", "/api/v1/jobs", `{"command": "make", "priority": 7}`, http.StatusBadRequest},
+		{"POST", "/api/v1/jobs", `{"command": "make", "tiemout_seconds": 60}`, http.StatusBadRequest},
+		{"GET", "/api/v1/jobs?status=done", "", http.StatusBadRequest},
+		{"GET", "/api/v1/jobs?limit=0", "", http.StatusBadRequest},
+		{"GET", "/api/v1/jobs/abc", "", http.StatusBadRequest},
+		{"POST", "/api/v1/pipelines", "jobs: [", http.StatusBadRequest},
+		{"GET", "/api/v1/nope", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			rec := apiRequest(t, tt.method, tt.path, "secret", tt.body)
+			assert.Equal(t, tt.status, rec.Code, rec.Body.String())
+			assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+		})
+	}
+}
+
+func TestAPIJobOptions(t *testing.T) {
+	req := apiJobRequest{
+		Command:        "make test",
+		Queue:          "ci",
+		TimeoutSeconds: 90,
+		Retry:          &apiRetryPolicy{MaxAttempts: 3, DelaySeconds: 1.5},
+		Requires:       []string{"os=linux"},
+	}
+	opts, err := req.jobOptions()
+	require.NoError(t, err)
+	assert.Equal(t, "ci", opts.Queue)
+	assert.Equal(t, 90*time.Second, opts.Timeout)
+	assert.Equal(t, 3, opts.Retry.MaxAttempts)
+	assert.Equal(t, 1500*time.Millisecond, opts.Retry.Delay)
+	assert.Equal(t, []string{"os=linux"}, opts.Requires)
+}
+
+func TestAPIErrorStatus(t *testing.T) {
+	assert.Equal(t, http.StatusNotFound, apiErrorStatus(fmt.Errorf("job 1 %w", queue.ErrJobNotFound)))
+	assert.Equal(t, http.StatusConflict, apiErrorStatus(fmt.Errorf("job 1 %w", queue.ErrJobFinished)))
+	assert.Equal(t, http.StatusConflict, apiErrorStatus(fmt.Errorf("job 1 %w", queue.ErrJobNotFinished)))
+	assert.Equal(t, http.StatusBadRequest, apiErrorStatus(&queue.ValidationError{Err: fmt.Errorf("no jobs defined")}))
+	assert.Equal(t, http.StatusInternalServerError, apiErrorStatus(fmt.Errorf("connection refused")))
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	var spec struct {
+		OpenAPI string                    `yaml:"openapi"`
+		Paths   map[string]map[string]any `yaml:"paths"`
+	}
+	require.NoError(t, yaml.Unmarshal(openAPISpec, &spec))
+	assert.Equal(t, "3.0.3", spec.OpenAPI)
+	for path, methods := range map[string][]string{
+		"/jobs":             {"get", "post"},
+		"/jobs/{id}":        {"get"},
+		"/jobs/{id}/cancel": {"post"},
+		"/jobs/{id}/retry":  {"post"},
+		"/pipelines":        {"post"},
+		"/queues":           {"get"},
+		"/queues/{name}":    {"get"},
+		"/workers":          {"get"},
+	} {
+		for _, method := range methods {
+			assert.Contains(t, spec.Paths[path], method, path)
+		}
+	}
+}
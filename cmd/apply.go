@@ -7,9 +7,12 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
 
 	"qq/pkg/database"
 	"qq/pkg/queue"
@@ -22,7 +25,11 @@ var applyCmd = &cobra.Command{
 	Long: `Submit a pipeline of jobs with dependencies from a YAML file.
 All jobs are inserted atomically — either all succeed or none are created.
 
+Every apply is recorded as a pipeline run, named after the file unless the
+YAML sets a name; see "qq pipeline ls" and "qq pipeline status".
+
 Example YAML file:
+  name: build-and-test
   jobs:
     - name: build
       command: "make build"
@@ -34,9 +41,40 @@ Example YAML file:
         - name: build
           condition: succeeded
 
+Pipelines can define variables in a vars: block and use them as
+{{ .vars.name }} in job commands, queues, env values and workdirs. --var and
+--var-file override the vars: block (--var wins over --var-file). To keep a
+literal "{{" in a command, write {{"{{"}}.
+
+A job with a matrix: block is expanded into one job per combination of its
+axis values, named like worker[chunk=3], and can use {{ .matrix.chunk }}.
+Depending on "worker" depends on every job it expanded to.
+
+A job can be deferred with schedule: (a time in any format "qq job add --at"
+accepts, read in timezone: set on the job or the pipeline) or delay: (a
+duration from when the pipeline is applied, e.g. 15m).
+
+A job with requires: (e.g. ["os=linux", "gpu"]) only runs on a worker whose
+labels satisfy every requirement, like "qq job add --requires".
+
+A run key (run_key: in the YAML, or --run-key) makes applying idempotent:
+while a run with the same key has unfinished jobs, applying again prints
+that run's jobs instead of submitting new ones. Once the run has finished
+the key can be used again. Run keys can use {{ .vars.name }}.
+
+--dry-run validates the pipeline without connecting to the database and
+prints its plan: the jobs grouped into levels, where the jobs of a level can
+run in parallel once the earlier levels have finished. --format dot or
+--format mermaid prints the dependency graph instead.
+
 Examples:
   qq apply -f pipeline.yaml
-  qq apply -f pipeline.yaml --db-url=postgres://localhost:5432/mydb`,
+  qq apply -f pipeline.yaml --db-url=postgres://localhost:5432/mydb
+  qq apply -f etl.yaml --var date=2025-03-01 --var-file prod.vars.yaml
+  qq apply -f etl.yaml --var date=2025-03-01 --render
+  qq apply -f nightly.yaml --run-key nightly-2025-03-01
+  qq apply -f pipeline.yaml --dry-run
+  qq apply -f pipeline.yaml --dry-run --format dot | dot -Tsvg > pipeline.svg`,
 	Run: func(cmd *cobra.Command, args []string) {
 		filePath, _ := cmd.Flags().GetString("file")
 		if filePath == "" {
@@ -50,6 +88,75 @@ Examples:
 			os.Exit(1)
 		}
 
+		// Parse the pipeline and set its variables
+		af, err := queue.ParseApplyFile(filePath)
+		if err != nil {
+			fmt.Printf("Failed to apply pipeline: %v\n", err)
+			os.Exit(1)
+		}
+		varFiles, _ := cmd.Flags().GetStringArray("var-file")
+		for _, varFile := range varFiles {
+			vars, err := queue.ParseVarFile(varFile)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			af.SetVars(vars)
+		}
+		varFlag, _ := cmd.Flags().GetStringArray("var")
+		vars, err := queue.ParseVarAssignments(varFlag)
+		if err != nil {
+			fmt.Printf("Error parsing --var: %v\n", err)
+			os.Exit(1)
+		}
+		af.SetVars(vars)
+		if runKey, _ := cmd.Flags().GetString("run-key"); runKey != "" {
+			af.RunKey = runKey
+		}
+
+		// Print the expanded pipeline or the plan instead of submitting it
+		render, _ := cmd.Flags().GetBool("render")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		format, _ := cmd.Flags().GetString("format")
+		if format != "text" && !dryRun {
+			fmt.Println("Error: --format requires --dry-run")
+			os.Exit(1)
+		}
+		if render || dryRun {
+			if err := af.Validate(); err != nil {
+				fmt.Printf("Validation error: %v\n", err)
+				os.Exit(1)
+			}
+			if err := af.Render(); err != nil {
+				fmt.Printf("Validation error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		if render {
+			enc := yaml.NewEncoder(os.Stdout)
+			enc.SetIndent(2)
+			if err := enc.Encode(af); err != nil {
+				fmt.Printf("Failed to render pipeline: %v\n", err)
+				os.Exit(1)
+			}
+			enc.Close()
+			return
+		}
+		if dryRun {
+			switch format {
+			case "text":
+				printPlan(af)
+			case "dot":
+				fmt.Print(af.DOT())
+			case "mermaid":
+				fmt.Print(af.Mermaid())
+			default:
+				fmt.Printf("Error: unknown format %q (must be text, dot or mermaid)\n", format)
+				os.Exit(1)
+			}
+			return
+		}
+
 		// Get database URL
 		dbURL := viper.GetString("db_url")
 		if dbURL == "" {
@@ -75,7 +182,7 @@ Examples:
 		}
 
 		// Apply the pipeline file
-		results, err := q.ApplyFile(ctx, filePath)
+		results, err := q.Apply(ctx, af)
 		if err != nil {
 			fmt.Printf("Failed to apply pipeline: %v\n", err)
 			os.Exit(1)
@@ -90,18 +197,63 @@ Examples:
 		}
 
 		// Count dependencies from the file for summary
-		af, _ := queue.ParseApplyFile(filePath)
-		if af != nil {
-			for _, job := range af.Jobs {
-				depCount += len(job.DependsOn)
-			}
+		for _, job := range af.Jobs {
+			depCount += len(job.DependsOn)
 		}
 
-		fmt.Printf("\nSubmitted %d jobs with %d dependencies\n", len(results), depCount)
+		if len(results) > 0 && results[0].Existing {
+			fmt.Printf("\nRun key %q has an unfinished run, no jobs were submitted\n", af.RunKey)
+		} else {
+			fmt.Printf("\nSubmitted %d jobs with %d dependencies\n", len(results), depCount)
+		}
+		if len(results) > 0 {
+			fmt.Printf("Pipeline run: %d (see \"qq pipeline status %d\")\n", results[0].RunID, results[0].RunID)
+		}
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(applyCmd)
 	applyCmd.Flags().StringP("file", "f", "", "Path to pipeline YAML file (required)")
+	applyCmd.Flags().StringArray("var", nil, "Set a pipeline variable as key=value (can be repeated)")
+	applyCmd.Flags().StringArray("var-file", nil, "YAML file of pipeline variables (can be repeated)")
+	applyCmd.Flags().Bool("render", false, "Print the pipeline with variables expanded instead of submitting it")
+	applyCmd.Flags().String("run-key", "", "Return the jobs of an unfinished run with this key instead of submitting again (overrides run_key:)")
+	applyCmd.Flags().Bool("dry-run", false, "Validate the pipeline and print its execution plan instead of submitting it")
+	applyCmd.Flags().String("format", "text", "Dry-run output format: text, dot or mermaid")
+}
+
+// printPlan prints the jobs of a pipeline level by level
+func printPlan(af *queue.ApplyFile) {
+	plan, err := af.Plan()
+	if err != nil {
+		fmt.Printf("Validation error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Pipeline %s: %d jobs in %d levels\n", af.Name, len(af.Jobs), len(plan))
+	for i, level := range plan {
+		if len(level) > 1 {
+			fmt.Printf("\nLevel %d (%d jobs in parallel)\n", i+1, len(level))
+		} else {
+			fmt.Printf("\nLevel %d\n", i+1)
+		}
+		fmt.Printf("%-24s %-15s %-8s %s\n", "NAME", "QUEUE", "PRIORITY", "DEPENDS ON")
+		for _, job := range level {
+			var deps []string
+			for _, dep := range job.DependsOn {
+				if dep.Condition == "finished" {
+					deps = append(deps, dep.Name+" (finished)")
+				} else {
+					deps = append(deps, dep.Name)
+				}
+			}
+			priority := "default"
+			if job.Priority > 0 {
+				priority = strconv.Itoa(job.Priority)
+			}
+			line := fmt.Sprintf("%-24s %-15s %-8s %s", job.Name, job.Queue, priority, strings.Join(deps, ", "))
+			fmt.Println(strings.TrimRight(line, " "))
+		}
+	}
 }
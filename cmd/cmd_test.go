@@ -2,11 +2,14 @@ package cmd
 
 import (
 	"bytes"
+	"html/template"
 	"os"
 	"testing"
 
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
+
+	"qq/pkg/queue"
 )
 
 func executeCommand(root *cobra.Command, args ...string) (output string, err error) {
@@ -52,4 +55,44 @@ func TestQueueCommandsHelp(t *testing.T) {
 	assert.NoError(t, err)
 	// Just verify the command runs without error
 	assert.Contains(t, output, "Usage:")
-}
\ No newline at end of file
+}
+
+func TestServerTemplatesParse(t *testing.T) {
+	for name, tmpl := range map[string]string{
+		"dashboard": dashboardTmpl,
+		"queue":     queueTmpl,
+		"job":       jobTmpl,
+		"pipeline":  pipelineTmpl,
+		"workers":   workersTmpl,
+	} {
+		_, err := template.New(name).Parse(tmpl)
+		assert.NoError(t, err, name)
+	}
+}
+
+func TestWorkersTemplate(t *testing.T) {
+	tmpl := template.Must(template.New("workers").Parse(workersTmpl))
+	data := struct {
+		Workers []queue.WorkerInfo
+	}{
+		Workers: []queue.WorkerInfo{{
+			ID:            "host-1",
+			Hostname:      "host",
+			Queues:        []queue.WorkerQueueInfo{{Name: "ci", MaxWorkers: 2, NumJobsRunning: 1}},
+			RunningJobIDs: []int64{42},
+			Lost:          true,
+		}},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, tmpl.Execute(&buf, data))
+	assert.Contains(t, buf.String(), `<a href="/job/42">42</a>`)
+	assert.Contains(t, buf.String(), "lost")
+}
+
+func TestMapJobStatus(t *testing.T) {
+	assert.Equal(t, "pending", mapJobStatus("available", ""))
+	assert.Equal(t, "blocked", mapJobStatus("pending", ""))
+	assert.Equal(t, "failed", mapJobStatus("cancelled", "cancelled"))
+	assert.Equal(t, "timeout", mapJobStatus("discarded", "timeout"))
+}
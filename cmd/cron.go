@@ -0,0 +1,24 @@
+/*
+Copyright © 2025 Will Atlas <will@atls.dev>
+*/
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// cronCmd represents the cron command
+var cronCmd = &cobra.Command{
+	Use:   "cron",
+	Short: "Manage recurring jobs",
+	Long: `The cron command allows you to manage recurring jobs.
+A cron schedule enqueues a command or applies a pipeline file on a cron spec.
+Schedules are stored in the database and fired by the running workers: each
+tick is enqueued exactly once, however many workers are running.`,
+	// This is a parent command that doesn't do anything itself
+	Run: nil,
+}
+
+func init() {
+	rootCmd.AddCommand(cronCmd)
+}
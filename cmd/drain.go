@@ -0,0 +1,67 @@
+/*
+Copyright © 2025 Will Atlas <will@atls.dev>
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"qq/pkg/database"
+	"qq/pkg/queue"
+)
+
+// workerDrainCmd represents the worker drain command
+var workerDrainCmd = &cobra.Command{
+	Use:   "drain [workerID]",
+	Short: "Ask a worker to drain and stop",
+	Long: `Ask a running worker to drain, as if it had received SIGTERM: it starts
+no new jobs, gives running jobs its --shutdown-timeout to finish, and exits.
+The worker picks up the request within a few seconds. Use "qq worker ls"
+to find worker IDs.
+
+Example:
+  qq worker drain host-1`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		workerID := args[0]
+		ctx := context.Background()
+
+		// Get database URL
+		dbURL := viper.GetString("db_url")
+		if dbURL == "" {
+			fmt.Println("Database URL is required. Use --db-url flag or set it in the config file.")
+			os.Exit(1)
+		}
+
+		// Connect to the database
+		db, err := database.New(ctx, dbURL)
+		if err != nil {
+			fmt.Printf("Failed to connect to the database: %v\n", err)
+			os.Exit(1)
+		}
+		defer db.Close()
+
+		// Initialize the queue client
+		q, err := queue.NewInsertOnlyClient(ctx, db.Pool)
+		if err != nil {
+			fmt.Printf("Failed to initialize the queue: %v\n", err)
+			os.Exit(1)
+		}
+
+		if err := q.RequestWorkerDrain(ctx, workerID); err != nil {
+			fmt.Printf("Failed to drain worker: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Asked worker %s to drain\n", workerID)
+	},
+}
+
+func init() {
+	workerCmd.AddCommand(workerDrainCmd)
+}
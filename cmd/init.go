@@ -13,6 +13,8 @@ import (
 	"github.com/riverqueue/river/rivermigrate"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+
+	"qq/pkg/queue"
 )
 
 // initCmd represents the init command
@@ -123,6 +125,16 @@ Examples:
 			fmt.Printf("Failed to create job_results table: %v\n", err)
 			os.Exit(1)
 		}
+
+		// Columns added after the initial release. ADD COLUMN IF NOT EXISTS
+		// keeps this safe to run against existing databases.
+		_, err = pool.Exec(ctx, `
+			ALTER TABLE job_results ADD COLUMN IF NOT EXISTS reason TEXT;
+		`)
+		if err != nil {
+			fmt.Printf("Failed to migrate job_results table: %v\n", err)
+			os.Exit(1)
+		}
 		
 		// Check if River job table exists for foreign key constraint
 		var riverJobTableExists bool
@@ -269,6 +281,285 @@ Examples:
 			}
 		}
 
+		// Create pipeline run tables. Every "qq apply" records a run with
+		// its source YAML and the jobs it inserted. "qq pipeline retry"
+		// adds the jobs it re-enqueues under the next attempt number.
+		// final_state keeps a job's terminal state after River's cleaner
+		// has deleted the job.
+		fmt.Println("Creating pipeline_runs tables (if not exists)...")
+		_, err = pool.Exec(ctx, `
+			CREATE TABLE IF NOT EXISTS pipeline_runs (
+				id BIGSERIAL PRIMARY KEY,
+				name TEXT NOT NULL,
+				source TEXT NOT NULL,
+				vars JSONB,
+				run_key TEXT,
+				submitted_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_pipeline_runs_run_key
+				ON pipeline_runs (run_key) WHERE run_key IS NOT NULL;
+
+			CREATE TABLE IF NOT EXISTS pipeline_run_jobs (
+				run_id BIGINT NOT NULL REFERENCES pipeline_runs (id) ON DELETE CASCADE,
+				job_id BIGINT NOT NULL,
+				name TEXT NOT NULL,
+				position INT NOT NULL,
+				attempt INT NOT NULL DEFAULT 1,
+				final_state TEXT,
+				PRIMARY KEY (run_id, name, attempt)
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_pipeline_run_jobs_job
+				ON pipeline_run_jobs (job_id);
+		`)
+		if err != nil {
+			fmt.Printf("Failed to create pipeline_runs tables: %v\n", err)
+			os.Exit(1)
+		}
+
+		// Create queue_configs table for queues defined with "qq queue add"
+		// and "qq queue set". Zero values leave the worker's or the job's own
+		// setting in place; global_limit caps the queue's running jobs
+		// across all workers.
+		fmt.Println("Creating queue_configs table (if not exists)...")
+		_, err = pool.Exec(ctx, `
+			CREATE TABLE IF NOT EXISTS queue_configs (
+				name TEXT PRIMARY KEY,
+				max_workers INT NOT NULL DEFAULT 0,
+				default_timeout_seconds INT NOT NULL DEFAULT 0,
+				default_priority INT NOT NULL DEFAULT 0,
+				description TEXT NOT NULL DEFAULT '',
+				global_limit INT NOT NULL DEFAULT 0,
+				created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+			);
+		`)
+		if err != nil {
+			fmt.Printf("Failed to create queue_configs table: %v\n", err)
+			os.Exit(1)
+		}
+
+		// Create queue_slots table. A job of a queue with a global limit
+		// holds a row while it runs; rows of jobs that are no longer running,
+		// e.g. because their worker died, don't count against the limit.
+		fmt.Println("Creating queue_slots table (if not exists)...")
+		_, err = pool.Exec(ctx, `
+			CREATE TABLE IF NOT EXISTS queue_slots (
+				job_id BIGINT PRIMARY KEY,
+				queue TEXT NOT NULL,
+				acquired_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+			);
+			CREATE INDEX IF NOT EXISTS idx_queue_slots_queue ON queue_slots(queue);
+		`)
+		if err != nil {
+			fmt.Printf("Failed to create queue_slots table: %v\n", err)
+			os.Exit(1)
+		}
+
+		// Create workers table. Each qq worker keeps its entry up to date with
+		// a heartbeat and removes it when it shuts down; "qq worker drain"
+		// sets drain_requested_at, which the worker sees on its heartbeat.
+		fmt.Println("Creating workers table (if not exists)...")
+		_, err = pool.Exec(ctx, `
+			CREATE TABLE IF NOT EXISTS workers (
+				id TEXT PRIMARY KEY,
+				hostname TEXT NOT NULL DEFAULT '',
+				pid INT NOT NULL DEFAULT 0,
+				version TEXT NOT NULL DEFAULT '',
+				labels JSONB NOT NULL DEFAULT '{}',
+				queues JSONB NOT NULL DEFAULT '[]',
+				running_job_ids BIGINT[] NOT NULL DEFAULT '{}',
+				jobs_completed BIGINT NOT NULL DEFAULT 0,
+				started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+				heartbeat_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+				drain_requested_at TIMESTAMPTZ
+			);
+		`)
+		if err != nil {
+			fmt.Printf("Failed to create workers table: %v\n", err)
+			os.Exit(1)
+		}
+
+		// Create queue_routes table. Jobs with requirements on worker labels
+		// are inserted into a River queue per queue and requirements, which
+		// only workers whose labels satisfy them add to their River client.
+		// used_at is when a job was last added to a route, which workers
+		// remove once its jobs are gone.
+		fmt.Println("Creating queue_routes table (if not exists)...")
+		_, err = pool.Exec(ctx, `
+			CREATE TABLE IF NOT EXISTS queue_routes (
+				name TEXT PRIMARY KEY,
+				queue TEXT NOT NULL,
+				requires JSONB NOT NULL,
+				used_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+			);
+			CREATE INDEX IF NOT EXISTS idx_queue_routes_queue ON queue_routes(queue);
+		`)
+		if err != nil {
+			fmt.Printf("Failed to create queue_routes table: %v\n", err)
+			os.Exit(1)
+		}
+
+		// Create cron_schedules table. Workers claim due schedules with
+		// FOR UPDATE SKIP LOCKED and move next_run_at forward in the same
+		// transaction that enqueues the jobs, so each tick fires once.
+		fmt.Println("Creating cron_schedules table (if not exists)...")
+		_, err = pool.Exec(ctx, `
+			CREATE TABLE IF NOT EXISTS cron_schedules (
+				id BIGSERIAL PRIMARY KEY,
+				name TEXT NOT NULL DEFAULT '',
+				spec TEXT NOT NULL,
+				command TEXT,
+				pipeline TEXT,
+				vars JSONB,
+				queue TEXT NOT NULL DEFAULT 'default',
+				priority INT NOT NULL DEFAULT 0,
+				paused BOOLEAN NOT NULL DEFAULT FALSE,
+				next_run_at TIMESTAMPTZ NOT NULL,
+				last_run_at TIMESTAMPTZ,
+				last_error TEXT,
+				created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+				CHECK ((command IS NULL) <> (pipeline IS NULL))
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_cron_schedules_next_run
+				ON cron_schedules (next_run_at) WHERE NOT paused;
+
+			-- Zero uses the queue's default priority; tables created before
+			-- queue defaults applied to cron jobs defaulted to 1
+			ALTER TABLE cron_schedules ALTER COLUMN priority SET DEFAULT 0;
+		`)
+		if err != nil {
+			fmt.Printf("Failed to create cron_schedules table: %v\n", err)
+			os.Exit(1)
+		}
+
+		// Create job_output_chunks table, which workers append to while a
+		// command runs so that its output can be followed live. Each chunk
+		// holds stdout or stderr and is timestamped with its first write.
+		fmt.Println("Creating job_output_chunks table (if not exists)...")
+		_, err = pool.Exec(ctx, `
+			CREATE TABLE IF NOT EXISTS job_output_chunks (
+				job_id BIGINT NOT NULL,
+				attempt INT NOT NULL,
+				seq INT NOT NULL,
+				stream TEXT NOT NULL DEFAULT 'stdout',
+				data TEXT NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+				PRIMARY KEY (job_id, attempt, seq)
+			);
+		`)
+		if err != nil {
+			fmt.Printf("Failed to create job_output_chunks table: %v\n", err)
+			os.Exit(1)
+		}
+
+		if riverJobTableExists {
+			var chunkFKExists bool
+			err = pool.QueryRow(ctx, `
+				SELECT EXISTS (
+					SELECT 1
+					FROM information_schema.table_constraints
+					WHERE constraint_name = 'fk_job_output_chunk_job'
+					AND table_name = 'job_output_chunks'
+				)
+			`).Scan(&chunkFKExists)
+			if err != nil {
+				fmt.Printf("Failed to check job_output_chunks constraints: %v\n", err)
+				fmt.Println("Continuing anyway...")
+			} else if !chunkFKExists {
+				fmt.Println("Adding foreign key constraint for job_output_chunks...")
+				_, err = pool.Exec(ctx, fmt.Sprintf(`
+					ALTER TABLE job_output_chunks
+					ADD CONSTRAINT fk_job_output_chunk_job
+					FOREIGN KEY (job_id) REFERENCES %s(id) ON DELETE CASCADE;
+				`, jobTableName))
+				if err != nil {
+					fmt.Printf("Failed to add job_output_chunks FK: %v\n", err)
+					fmt.Println("Continuing anyway...")
+				}
+			}
+
+			// Jobs with dependencies are inserted in River's pending state
+			// (shown as "blocked"). When a job finishes, this trigger:
+			//  - records its final state for pipeline runs it belongs to;
+			//  - if it was cancelled or discarded, cancels every transitive
+			//    dependent that needed it to succeed, recording the reason
+			//    "upstream job N failed";
+			//  - makes its other dependents available once all of their
+			//    dependencies have finished, and wakes workers with the
+			//    notification River sends for inserted jobs.
+			// The cancellations fire the trigger again, which releases
+			// dependents that only needed the cancelled jobs to finish.
+			fmt.Println("Creating dependency release trigger...")
+			_, err = pool.Exec(ctx, fmt.Sprintf(`
+				CREATE OR REPLACE FUNCTION qq_release_dependents() RETURNS trigger AS $$
+				DECLARE
+					released RECORD;
+				BEGIN
+					UPDATE pipeline_run_jobs SET final_state = NEW.state WHERE job_id = NEW.id;
+
+					IF NEW.state IN ('cancelled', 'discarded') THEN
+						WITH RECURSIVE doomed(id) AS (
+							SELECT d.job_id
+							FROM job_dependencies d
+							WHERE d.depends_on_job_id = NEW.id AND d.condition = 'succeeded'
+							UNION
+							SELECT d.job_id
+							FROM job_dependencies d
+							JOIN doomed ON d.depends_on_job_id = doomed.id
+							WHERE d.condition = 'succeeded'
+						),
+						cancelled AS (
+							UPDATE %[1]s j
+							SET state = 'cancelled', finalized_at = NOW()
+							FROM doomed
+							WHERE j.id = doomed.id
+							AND j.state IN ('pending', 'available', 'scheduled', 'retryable')
+							RETURNING j.id, j.attempt
+						)
+						INSERT INTO job_results (job_id, attempt, output, exit_code, reason, created_at)
+						SELECT id, attempt, '', %[2]d, 'upstream job ' || NEW.id || ' failed', NOW()
+						FROM cancelled
+						ON CONFLICT (job_id, attempt) DO UPDATE SET
+							reason = EXCLUDED.reason;
+					END IF;
+
+					FOR released IN
+						UPDATE %[1]s j
+						SET state = CASE WHEN j.scheduled_at > NOW() THEN 'scheduled' ELSE 'available' END::river_job_state
+						WHERE j.state = 'pending'
+						AND j.id IN (SELECT d.job_id FROM job_dependencies d WHERE d.depends_on_job_id = NEW.id)
+						AND NOT EXISTS (
+							SELECT 1
+							FROM job_dependencies d
+							JOIN %[1]s u ON u.id = d.depends_on_job_id
+							WHERE d.job_id = j.id
+							AND u.state NOT IN ('completed', 'cancelled', 'discarded')
+						)
+						RETURNING j.queue, j.state
+					LOOP
+						IF released.state = 'available' THEN
+							PERFORM pg_notify(current_schema() || '.river_insert', json_build_object('queue', released.queue)::text);
+						END IF;
+					END LOOP;
+					RETURN NULL;
+				END;
+				$$ LANGUAGE plpgsql;
+
+				DROP TRIGGER IF EXISTS qq_release_dependents ON %[1]s;
+				CREATE TRIGGER qq_release_dependents
+				AFTER UPDATE OF state ON %[1]s
+				FOR EACH ROW
+				WHEN (NEW.state IN ('completed', 'cancelled', 'discarded') AND OLD.state IS DISTINCT FROM NEW.state)
+				EXECUTE FUNCTION qq_release_dependents();
+			`, jobTableName, queue.ExitCodeCancelled))
+			if err != nil {
+				fmt.Printf("Failed to create dependency release trigger: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
 		fmt.Println("Initialization complete! The database is now ready for use.")
 	},
 }
@@ -6,6 +6,8 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -23,6 +25,7 @@ var jobLsCmd = &cobra.Command{
 Examples:
   qq job ls
   qq job ls --status=pending
+  qq job ls --status=blocked
   qq job ls --queue=high_priority`,
 	Run: func(cmd *cobra.Command, args []string) {
 		status, _ := cmd.Flags().GetString("status")
@@ -89,12 +92,19 @@ Examples:
 			switch job.State {
 			case "available", "scheduled":
 				status = "pending"
+			case "pending":
+				// River's pending state holds jobs waiting for dependencies
+				status = "blocked"
 			case "running":
 				status = "running"
 			case "completed":
 				status = "completed"
 			case "discarded", "cancelled":
-				status = "failed    "
+				if job.Reason == queue.ReasonTimeout {
+					status = "timeout   "
+				} else {
+					status = "failed    "
+				}
 			case "retryable":
 				status = "retryable"
 			default:
@@ -102,6 +112,9 @@ Examples:
 			}
 
 			fmt.Printf("%d\t%s\t\t%s\t%s\t%d\n", job.ID, job.Queue, status, job.Command, job.ExitCode)
+			if job.Unroutable {
+				fmt.Printf("\tno live worker on queue %s satisfies: %s\n", job.Queue, strings.Join(job.Requires, ", "))
+			}
 
 		}
 	},
@@ -146,47 +159,226 @@ Example:
 			}
 		}()
 
-		// Execute a query to get queue stats
-		// River doesn't have a direct API for this, so we need to query the database
-		rows, err := db.Pool.Query(ctx, `
-			SELECT 
-				queue, 
-				COUNT(*) FILTER (WHERE state IN ('available', 'scheduled')) AS pending,
-				COUNT(*) FILTER (WHERE state = 'running') AS running,
-				COUNT(*) FILTER (WHERE state = 'completed') AS completed
-			FROM 
-				river_job
-			GROUP BY 
-				queue
-			ORDER BY 
-				queue
-		`)
+		stats, err := q.GetQueueStats(ctx, "")
 		if err != nil {
 			fmt.Printf("Failed to query queues: %v\n", err)
 			return
 		}
-		defer rows.Close()
 
 		fmt.Println("Listing all queues:")
-		fmt.Println("\nName\t\tPending\tRunning\tCompleted")
-		fmt.Println("--------------------------------------------------")
+		fmt.Println("\nName\t\tState\tPending\tBlocked\tRunning\tCompleted\tMax Workers\tLimit\tDescription")
+		fmt.Println("--------------------------------------------------------------------------------------------")
+
+		for _, stat := range stats {
+			state := "active"
+			if stat.Paused {
+				state = "paused"
+			}
+			maxWorkers := "-"
+			if stat.MaxWorkers > 0 {
+				maxWorkers = fmt.Sprintf("%d", stat.MaxWorkers)
+			}
+			limit := "-"
+			if stat.GlobalLimit > 0 {
+				limit = fmt.Sprintf("%d/%d", stat.LimitUsed, stat.GlobalLimit)
+			}
+			fmt.Printf("%s\t\t%s\t%d\t%d\t%d\t%d\t\t%s\t\t%s\t%s\n", stat.Name, state, stat.Pending, stat.Blocked, stat.Running, stat.Completed, maxWorkers, limit, stat.Description)
+		}
+
+		if len(stats) == 0 {
+			fmt.Println("No queues found.")
+		}
+	},
+}
+
+// pipelineLsCmd represents the pipeline ls command
+var pipelineLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List pipeline runs",
+	Long: `List the most recent pipeline runs with their overall state.
+
+Examples:
+  qq pipeline ls
+  qq pipeline ls --limit=50`,
+	Run: func(cmd *cobra.Command, args []string) {
+		limit, _ := cmd.Flags().GetInt("limit")
+
+		// Create a context for the operation
+		ctx := context.Background()
+
+		// Get database URL from config
+		dbURL := viper.GetString("db_url")
+		if dbURL == "" {
+			fmt.Println("Database URL is required. Use --db-url flag or set it in the config file.")
+			return
+		}
+
+		// Connect to the database
+		db, err := database.New(ctx, dbURL)
+		if err != nil {
+			fmt.Printf("Failed to connect to the database: %v\n", err)
+			return
+		}
+		defer db.Close()
+
+		// Initialize the queue client
+		q, err := queue.NewInsertOnlyClient(ctx, db.Pool)
+		if err != nil {
+			fmt.Printf("Failed to initialize the queue: %v\n", err)
+			return
+		}
+
+		runs, err := q.ListPipelineRuns(ctx, limit)
+		if err != nil {
+			fmt.Printf("Failed to list pipeline runs: %v\n", err)
+			return
+		}
+
+		fmt.Printf("%-8s %-25s %-10s %s\n", "RUN", "NAME", "STATE", "SUBMITTED")
+		fmt.Printf("%-8s %-25s %-10s %s\n", "---", "----", "-----", "---------")
+		if len(runs) == 0 {
+			fmt.Println("No pipeline runs found.")
+			return
+		}
+		for _, run := range runs {
+			fmt.Printf("%-8d %-25s %-10s %s\n", run.ID, run.Name, run.State, run.SubmittedAt.Format(time.RFC3339))
+		}
+	},
+}
+
+// cronLsCmd represents the cron ls command
+var cronLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List recurring jobs",
+	Long: `List cron schedules with their next and last run times.
+
+Example:
+  qq cron ls`,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Create a context for the operation
+		ctx := context.Background()
+
+		// Get database URL from config
+		dbURL := viper.GetString("db_url")
+		if dbURL == "" {
+			fmt.Println("Database URL is required. Use --db-url flag or set it in the config file.")
+			return
+		}
 
-		queueCount := 0
-		for rows.Next() {
-			var queueName string
-			var pending, running, completed int
+		// Connect to the database
+		db, err := database.New(ctx, dbURL)
+		if err != nil {
+			fmt.Printf("Failed to connect to the database: %v\n", err)
+			return
+		}
+		defer db.Close()
 
-			if err := rows.Scan(&queueName, &pending, &running, &completed); err != nil {
-				fmt.Printf("Error scanning row: %v\n", err)
-				continue
+		// Initialize the queue client
+		q, err := queue.NewInsertOnlyClient(ctx, db.Pool)
+		if err != nil {
+			fmt.Printf("Failed to initialize the queue: %v\n", err)
+			return
+		}
+
+		schedules, err := q.ListCronSchedules(ctx)
+		if err != nil {
+			fmt.Printf("Failed to list cron schedules: %v\n", err)
+			return
+		}
+
+		fmt.Printf("%-6s %-20s %-20s %-8s %-25s %-25s %s\n", "ID", "NAME", "SPEC", "STATE", "NEXT RUN", "LAST RUN", "TARGET")
+		fmt.Printf("%-6s %-20s %-20s %-8s %-25s %-25s %s\n", "--", "----", "----", "-----", "--------", "--------", "------")
+		if len(schedules) == 0 {
+			fmt.Println("No cron schedules found.")
+			return
+		}
+		for _, s := range schedules {
+			state := "active"
+			if s.Paused {
+				state = "paused"
 			}
+			lastRun := "-"
+			if s.LastRunAt != nil {
+				lastRun = s.LastRunAt.Format(time.RFC3339)
+			}
+			target := s.Command
+			if s.Pipeline != "" {
+				target = "pipeline " + s.Name
+			}
+			fmt.Printf("%-6d %-20s %-20s %-8s %-25s %-25s %s\n", s.ID, s.Name, s.Spec, state, s.NextRunAt.Format(time.RFC3339), lastRun, target)
+			if s.LastError != "" {
+				fmt.Printf("       last tick failed: %s\n", s.LastError)
+			}
+		}
+	},
+}
+
+// workerLsCmd represents the worker ls command
+var workerLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List workers",
+	Long: `List the qq worker processes with their host, PID, version, queues
+and jobs. Workers report in every few seconds; one that stopped reporting
+without shutting down is shown as lost, and one that is finishing its jobs
+before it exits as draining.
+
+Example:
+  qq worker ls`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
 
-			fmt.Printf("%s\t\t%d\t%d\t%d\n", queueName, pending, running, completed)
-			queueCount++
+		// Get database URL
+		dbURL := viper.GetString("db_url")
+		if dbURL == "" {
+			fmt.Println("Database URL is required. Use --db-url flag or set it in the config file.")
+			return
 		}
 
-		if queueCount == 0 {
-			fmt.Println("No queues found.")
+		// Connect to the database
+		db, err := database.New(ctx, dbURL)
+		if err != nil {
+			fmt.Printf("Failed to connect to the database: %v\n", err)
+			return
+		}
+		defer db.Close()
+
+		// Initialize the queue client
+		q, err := queue.NewInsertOnlyClient(ctx, db.Pool)
+		if err != nil {
+			fmt.Printf("Failed to initialize the queue: %v\n", err)
+			return
+		}
+
+		workers, err := q.ListWorkers(ctx)
+		if err != nil {
+			fmt.Printf("Failed to list workers: %v\n", err)
+			return
+		}
+
+		fmt.Printf("%-40s %-20s %-8s %-8s %-9s %-8s %-10s %-25s %s\n", "ID", "HOST", "PID", "VERSION", "STATE", "RUNNING", "COMPLETED", "LAST HEARTBEAT", "QUEUES")
+		fmt.Printf("%-40s %-20s %-8s %-8s %-9s %-8s %-10s %-25s %s\n", "--", "----", "---", "-------", "-----", "-------", "---------", "--------------", "------")
+		if len(workers) == 0 {
+			fmt.Println("No workers found.")
+			return
+		}
+		for _, w := range workers {
+			state := "active"
+			switch {
+			case w.Lost:
+				state = "lost"
+			case w.Draining:
+				state = "draining"
+			}
+			queues := make([]string, len(w.Queues))
+			for i, qi := range w.Queues {
+				queues[i] = fmt.Sprintf("%s (%d/%d)", qi.Name, qi.NumJobsRunning, qi.MaxWorkers)
+			}
+			fmt.Printf("%-40s %-20s %-8d %-8s %-9s %-8d %-10d %-25s %s\n", w.ID, w.Hostname, w.PID, w.Version, state,
+				len(w.RunningJobIDs), w.JobsCompleted, w.HeartbeatAt.Format(time.RFC3339), strings.Join(queues, ", "))
+			if len(w.Labels) > 0 {
+				fmt.Printf("%-40s labels: %s\n", "", formatLabels(w.Labels))
+			}
 		}
 	},
 }
@@ -198,8 +390,18 @@ func init() {
 	// Add queueLsCmd to the queue command
 	queueCmd.AddCommand(queueLsCmd)
 
+	// Add pipelineLsCmd to the pipeline command
+	pipelineCmd.AddCommand(pipelineLsCmd)
+	pipelineLsCmd.Flags().IntP("limit", "l", 20, "Limit the number of results")
+
+	// Add cronLsCmd to the cron command
+	cronCmd.AddCommand(cronLsCmd)
+
+	// Add workerLsCmd to the worker command
+	workerCmd.AddCommand(workerLsCmd)
+
 	// Add flags for job ls command
-	jobLsCmd.Flags().StringP("status", "s", "", "Filter by status (pending, running, completed, failed)")
+	jobLsCmd.Flags().StringP("status", "s", "", "Filter by status (pending, blocked, running, completed, failed)")
 	jobLsCmd.Flags().StringP("queue", "q", "", "Filter by queue name")
 	jobLsCmd.Flags().IntP("limit", "l", 20, "Limit the number of results")
 }
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -22,10 +23,20 @@ var jobOutputCmd = &cobra.Command{
 	Use:   "output [jobID]",
 	Short: "Show the complete output of a job",
 	Long: `Show the complete output of a job with the given ID.
-This includes the full command output and exit code.
+This includes the full command output, exit code and, for jobs that
+qq ended itself (e.g. cancelled with "qq job rm"), the reason.
 
-Example:
-  qq job output 123`,
+Retried jobs keep the output of every attempt. The latest attempt is
+shown by default; use --attempt to see an earlier one.
+
+Output is shown with stdout and stderr merged by default. Use --stdout or
+--stderr to see a single stream, and --timestamps to prefix every line
+with the time it was written.
+
+Examples:
+  qq job output 123
+  qq job output 123 --attempt 1
+  qq job output 123 --stderr --timestamps`,
 	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		// Parse the job ID from the arguments
@@ -66,53 +77,196 @@ Example:
 		}()
 
 		follow, _ := cmd.Flags().GetBool("follow")
+		printer := newChunkPrinter(cmd)
 
 		if follow {
-			lastOutputLen := 0
+			followJob(ctx, q, jobID, printer)
+		} else {
+			// Get the job with its latest result
+			job, err := q.GetJob(ctx, jobID)
+			if err != nil {
+				fmt.Printf("Failed to get job output: %v\n", err)
+				return
+			}
 
-			for {
-				job, err := q.GetJob(ctx, jobID)
+			// An earlier attempt of a retried job was asked for
+			attemptNum, _ := cmd.Flags().GetInt("attempt")
+			if attemptNum > 0 && attemptNum != job.Attempt {
+				attempts, err := q.GetJobAttempts(ctx, jobID)
 				if err != nil {
-					fmt.Printf("Failed to get job status: %v\n", err)
+					fmt.Printf("Failed to get job output: %v\n", err)
 					return
 				}
-
-				// Print any new output since last check
-				if len(job.Output) > lastOutputLen {
-					fmt.Print(job.Output[lastOutputLen:])
-					lastOutputLen = len(job.Output)
-				}
-
-				// Check if the job has reached a terminal state
-				switch job.State {
-				case "completed":
-					os.Exit(job.ExitCode)
-				case "discarded", "cancelled":
-					if lastOutputLen == 0 {
-						fmt.Printf("Job %d failed (state: %s)\n", jobID, job.State)
+				found := false
+				for _, a := range attempts {
+					if a.Attempt == attemptNum {
+						job.Attempt, job.Output, job.ExitCode, job.Reason = a.Attempt, a.Output, a.ExitCode, a.Reason
+						found = true
 					}
-					os.Exit(1)
 				}
+				if !found {
+					fmt.Printf("Job %d has no recorded result for attempt %d\n", jobID, attemptNum)
+					return
+				}
+			}
+
+			// Display the job information
+			fmt.Printf("Output for job %d:\n\n", jobID)
+			fmt.Printf("State: %s\n", job.State)
+			fmt.Printf("Attempt: %d\n", job.Attempt)
+			fmt.Printf("Exit Code: %d\n", job.ExitCode)
+			if job.Reason != "" {
+				fmt.Printf("Reason: %s\n", job.Reason)
+			}
+			if len(job.Requires) > 0 {
+				fmt.Printf("Requires: %s\n", strings.Join(job.Requires, ", "))
+			}
+			if job.Unroutable {
+				fmt.Printf("Warning: no live worker on queue %s has labels satisfying the job's requirements\n", job.Queue)
+			}
 
-				time.Sleep(500 * time.Millisecond)
+			if printer.streams == nil && !printer.timestamps {
+				fmt.Printf("\nOutput:\n%s\n", job.Output)
+				return
 			}
-		} else {
-			// Get the job output
-			output, exitCode, err := q.GetJobOutput(ctx, jobID)
+
+			// Per-stream and timestamped views are rendered from the chunks
+			// the worker streamed
+			chunks, err := q.GetOutputChunks(ctx, jobID, job.Attempt, 0)
 			if err != nil {
 				fmt.Printf("Failed to get job output: %v\n", err)
 				return
 			}
-
-			// Display the job information
-			fmt.Printf("Output for job %d:\n\n", jobID)
-			fmt.Printf("Exit Code: %d\n\n", exitCode)
-			fmt.Printf("Output:\n%s\n", output)
+			fmt.Printf("\nOutput:\n")
+			if len(chunks) == 0 && job.Output != "" {
+				fmt.Println("(no per-stream output recorded for this attempt, showing merged output)")
+				fmt.Println(job.Output)
+				return
+			}
+			for _, c := range chunks {
+				printer.print(c)
+			}
+			printer.finish()
 		}
 	},
 }
 
+// chunkPrinter renders streamed output chunks, optionally limited to some
+// streams and with every line prefixed by the time it was written
+type chunkPrinter struct {
+	streams    map[string]bool // nil prints every stream
+	timestamps bool
+	midLine    bool
+}
+
+// newChunkPrinter builds a chunkPrinter from the --stdout, --stderr and
+// --timestamps flags of cmd, if it has them
+func newChunkPrinter(cmd *cobra.Command) *chunkPrinter {
+	p := &chunkPrinter{}
+	stdout, _ := cmd.Flags().GetBool("stdout")
+	stderr, _ := cmd.Flags().GetBool("stderr")
+	if stdout || stderr {
+		p.streams = map[string]bool{queue.StreamStdout: stdout, queue.StreamStderr: stderr}
+	}
+	p.timestamps, _ = cmd.Flags().GetBool("timestamps")
+	return p
+}
+
+func (p *chunkPrinter) print(c queue.OutputChunk) {
+	if p.streams != nil && !p.streams[c.Stream] {
+		return
+	}
+	if !p.timestamps {
+		fmt.Print(c.Data)
+		return
+	}
+
+	prefix := c.CreatedAt.Local().Format("2006-01-02T15:04:05.000") + " "
+	for _, line := range strings.SplitAfter(c.Data, "\n") {
+		if line == "" {
+			continue
+		}
+		if !p.midLine {
+			fmt.Print(prefix)
+		}
+		fmt.Print(line)
+		p.midLine = !strings.HasSuffix(line, "\n")
+	}
+}
+
+// finish terminates a trailing partial line
+func (p *chunkPrinter) finish() {
+	if p.midLine {
+		fmt.Println()
+		p.midLine = false
+	}
+}
+
+// followJob prints a job's output as the worker streams it until the job
+// reaches a terminal state, then exits with the job's exit code
+func followJob(ctx context.Context, q *queue.QueueClient, jobID int64, printer *chunkPrinter) {
+	attempt := -1
+	lastSeq := 0
+	printed := false
+
+	for {
+		// The state is read before the chunks, so once it is terminal the
+		// chunks read afterwards are complete
+		job, err := q.GetJob(ctx, jobID)
+		if err != nil {
+			fmt.Printf("Failed to get job status: %v\n", err)
+			os.Exit(1)
+		}
+
+		// A retried job streams each attempt separately
+		if job.Attempt != attempt {
+			if attempt > 0 {
+				printer.finish()
+				fmt.Printf("\n--- attempt %d ---\n", job.Attempt)
+			}
+			attempt = job.Attempt
+			lastSeq = 0
+		}
+
+		chunks, err := q.GetOutputChunks(ctx, jobID, attempt, lastSeq)
+		if err != nil {
+			fmt.Printf("Failed to get job output: %v\n", err)
+			os.Exit(1)
+		}
+		for _, c := range chunks {
+			printer.print(c)
+			lastSeq = c.Seq
+			printed = true
+		}
+
+		// Check if the job has reached a terminal state
+		switch job.State {
+		case "completed":
+			printer.finish()
+			if !printed {
+				// Finished before its output was streamed
+				fmt.Print(job.Output)
+			}
+			os.Exit(job.ExitCode)
+		case "discarded", "cancelled":
+			printer.finish()
+			if job.Reason != "" {
+				fmt.Printf("Job %d %s\n", jobID, job.Reason)
+			} else if !printed {
+				fmt.Printf("Job %d failed (state: %s)\n", jobID, job.State)
+			}
+			os.Exit(1)
+		}
+
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
 func init() {
 	jobCmd.AddCommand(jobOutputCmd)
 	jobOutputCmd.Flags().BoolP("follow", "f", false, "Follow job output until completion")
+	jobOutputCmd.Flags().IntP("attempt", "a", 0, "Show the output of a specific attempt (default: latest)")
+	jobOutputCmd.Flags().Bool("stdout", false, "Only show standard output")
+	jobOutputCmd.Flags().Bool("stderr", false, "Only show standard error")
+	jobOutputCmd.Flags().BoolP("timestamps", "t", false, "Prefix each line with the time it was written")
 }
@@ -0,0 +1,117 @@
+/*
+Copyright © 2025 Will Atlas <will@atls.dev>
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"qq/pkg/database"
+	"qq/pkg/queue"
+)
+
+// cronPauseCmd represents the cron pause command
+var cronPauseCmd = &cobra.Command{
+	Use:   "pause [scheduleID]",
+	Short: "Pause a recurring job",
+	Long: `Pause a cron schedule. It enqueues nothing until it is resumed with
+"qq cron resume".
+
+Example:
+  qq cron pause 3`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		id, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			fmt.Printf("Invalid cron schedule ID: %v\n", err)
+			os.Exit(1)
+		}
+
+		ctx := context.Background()
+
+		// Get database URL
+		dbURL := viper.GetString("db_url")
+		if dbURL == "" {
+			fmt.Println("Database URL is required. Use --db-url flag or set it in the config file.")
+			os.Exit(1)
+		}
+
+		// Connect to the database
+		db, err := database.New(ctx, dbURL)
+		if err != nil {
+			fmt.Printf("Failed to connect to the database: %v\n", err)
+			os.Exit(1)
+		}
+		defer db.Close()
+
+		// Initialize the queue client
+		q, err := queue.NewInsertOnlyClient(ctx, db.Pool)
+		if err != nil {
+			fmt.Printf("Failed to initialize the queue: %v\n", err)
+			os.Exit(1)
+		}
+
+		if err := q.SetCronSchedulePaused(ctx, id, true); err != nil {
+			fmt.Printf("Failed to pause cron schedule: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Paused cron schedule %d\n", id)
+	},
+}
+
+// queuePauseCmd represents the queue pause command
+var queuePauseCmd = &cobra.Command{
+	Use:   "pause [name]",
+	Short: "Pause a queue",
+	Long: `Pause a queue. Workers finish the jobs they are running but start no new
+jobs from the queue until it is resumed with "qq queue resume". Jobs can
+still be added to a paused queue.
+
+Example:
+  qq queue pause ci`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		queueName := args[0]
+
+		ctx := context.Background()
+
+		// Get database URL
+		dbURL := viper.GetString("db_url")
+		if dbURL == "" {
+			fmt.Println("Database URL is required. Use --db-url flag or set it in the config file.")
+			os.Exit(1)
+		}
+
+		// Connect to the database
+		db, err := database.New(ctx, dbURL)
+		if err != nil {
+			fmt.Printf("Failed to connect to the database: %v\n", err)
+			os.Exit(1)
+		}
+		defer db.Close()
+
+		// Initialize the queue client
+		q, err := queue.NewInsertOnlyClient(ctx, db.Pool)
+		if err != nil {
+			fmt.Printf("Failed to initialize the queue: %v\n", err)
+			os.Exit(1)
+		}
+
+		if err := q.PauseQueue(ctx, queueName); err != nil {
+			fmt.Printf("Failed to pause queue: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Paused queue %s\n", queueName)
+	},
+}
+
+func init() {
+	cronCmd.AddCommand(cronPauseCmd)
+	queueCmd.AddCommand(queuePauseCmd)
+}
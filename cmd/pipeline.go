@@ -0,0 +1,24 @@
+/*
+Copyright © 2025 Will Atlas <will@atls.dev>
+*/
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// pipelineCmd represents the pipeline command
+var pipelineCmd = &cobra.Command{
+	Use:     "pipeline",
+	Aliases: []string{"pipelines", "p"},
+	Short:   "Inspect pipeline runs",
+	Long: `The pipeline command allows you to inspect pipeline runs.
+Every "qq apply" records a run with its source YAML and the jobs it submitted.
+Use the subcommands to list runs or see the status of one.`,
+	// This is a parent command that doesn't do anything itself
+	Run: nil,
+}
+
+func init() {
+	rootCmd.AddCommand(pipelineCmd)
+}
@@ -13,7 +13,7 @@ var queueCmd = &cobra.Command{
 	Aliases: []string{"queues", "q"},
 	Short:   "Manage queues",
 	Long: `The queue command allows you to manage queues.
-Use the subcommands to add, remove, or list queues.`,
+Use the subcommands to add, change, remove, list, pause, or resume queues.`,
 	// This is a parent command that doesn't do anything itself
 	Run: nil,
 }
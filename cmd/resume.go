@@ -0,0 +1,115 @@
+/*
+Copyright © 2025 Will Atlas <will@atls.dev>
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"qq/pkg/database"
+	"qq/pkg/queue"
+)
+
+// cronResumeCmd represents the cron resume command
+var cronResumeCmd = &cobra.Command{
+	Use:   "resume [scheduleID]",
+	Short: "Resume a paused recurring job",
+	Long: `Resume a paused cron schedule. It continues from its next tick; ticks
+missed while it was paused are skipped.
+
+Example:
+  qq cron resume 3`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		id, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			fmt.Printf("Invalid cron schedule ID: %v\n", err)
+			os.Exit(1)
+		}
+
+		ctx := context.Background()
+
+		// Get database URL
+		dbURL := viper.GetString("db_url")
+		if dbURL == "" {
+			fmt.Println("Database URL is required. Use --db-url flag or set it in the config file.")
+			os.Exit(1)
+		}
+
+		// Connect to the database
+		db, err := database.New(ctx, dbURL)
+		if err != nil {
+			fmt.Printf("Failed to connect to the database: %v\n", err)
+			os.Exit(1)
+		}
+		defer db.Close()
+
+		// Initialize the queue client
+		q, err := queue.NewInsertOnlyClient(ctx, db.Pool)
+		if err != nil {
+			fmt.Printf("Failed to initialize the queue: %v\n", err)
+			os.Exit(1)
+		}
+
+		if err := q.SetCronSchedulePaused(ctx, id, false); err != nil {
+			fmt.Printf("Failed to resume cron schedule: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Resumed cron schedule %d\n", id)
+	},
+}
+
+// queueResumeCmd represents the queue resume command
+var queueResumeCmd = &cobra.Command{
+	Use:   "resume [name]",
+	Short: "Resume a paused queue",
+	Long: `Resume a paused queue. Workers start picking up its jobs again.
+
+Example:
+  qq queue resume ci`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		queueName := args[0]
+
+		ctx := context.Background()
+
+		// Get database URL
+		dbURL := viper.GetString("db_url")
+		if dbURL == "" {
+			fmt.Println("Database URL is required. Use --db-url flag or set it in the config file.")
+			os.Exit(1)
+		}
+
+		// Connect to the database
+		db, err := database.New(ctx, dbURL)
+		if err != nil {
+			fmt.Printf("Failed to connect to the database: %v\n", err)
+			os.Exit(1)
+		}
+		defer db.Close()
+
+		// Initialize the queue client
+		q, err := queue.NewInsertOnlyClient(ctx, db.Pool)
+		if err != nil {
+			fmt.Printf("Failed to initialize the queue: %v\n", err)
+			os.Exit(1)
+		}
+
+		if err := q.ResumeQueue(ctx, queueName); err != nil {
+			fmt.Printf("Failed to resume queue: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Resumed queue %s\n", queueName)
+	},
+}
+
+func init() {
+	cronCmd.AddCommand(cronResumeCmd)
+	queueCmd.AddCommand(queueResumeCmd)
+}
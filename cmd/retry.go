@@ -0,0 +1,81 @@
+/*
+Copyright © 2025 Will Atlas <will@atls.dev>
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"qq/pkg/database"
+	"qq/pkg/queue"
+)
+
+// pipelineRetryCmd represents the pipeline retry command
+var pipelineRetryCmd = &cobra.Command{
+	Use:   "retry [runID]",
+	Short: "Re-run the failed part of a pipeline run",
+	Long: `Re-enqueue the failed, cancelled and never-run jobs of a finished pipeline
+run. Jobs that succeeded are not run again: they satisfy the dependencies of
+the re-enqueued jobs. The new jobs belong to the same run, so
+"qq pipeline status" shows the run's latest state.
+
+Examples:
+  qq pipeline retry 12`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runID, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			fmt.Printf("Invalid pipeline run ID: %v\n", err)
+			os.Exit(1)
+		}
+
+		ctx := context.Background()
+
+		// Get database URL from config
+		dbURL := viper.GetString("db_url")
+		if dbURL == "" {
+			fmt.Println("Database URL is required. Use --db-url flag or set it in the config file.")
+			os.Exit(1)
+		}
+
+		// Connect to the database
+		db, err := database.New(ctx, dbURL)
+		if err != nil {
+			fmt.Printf("Failed to connect to the database: %v\n", err)
+			os.Exit(1)
+		}
+		defer db.Close()
+
+		// Create insert-only client (no workers started)
+		q, err := queue.NewInsertOnlyClient(ctx, db.Pool)
+		if err != nil {
+			fmt.Printf("Failed to initialize queue client: %v\n", err)
+			os.Exit(1)
+		}
+
+		results, err := q.RetryPipelineRun(ctx, runID)
+		if err != nil {
+			fmt.Printf("Failed to retry pipeline run: %v\n", err)
+			os.Exit(1)
+		}
+
+		// Print results table
+		fmt.Printf("\n%-20s %-10s %-15s\n", "NAME", "JOB ID", "QUEUE")
+		fmt.Printf("%-20s %-10s %-15s\n", "----", "------", "-----")
+		for _, r := range results {
+			fmt.Printf("%-20s %-10d %-15s\n", r.Name, r.JobID, r.Queue)
+		}
+
+		fmt.Printf("\nRe-enqueued %d jobs of pipeline run %d\n", len(results), runID)
+	},
+}
+
+func init() {
+	pipelineCmd.AddCommand(pipelineRetryCmd)
+}
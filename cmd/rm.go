@@ -4,19 +4,32 @@ Copyright © 2025 Will Atlas <will@atls.dev>
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"strconv"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"qq/pkg/database"
+	"qq/pkg/queue"
 )
 
 // jobRmCmd represents the job rm command
 var jobRmCmd = &cobra.Command{
 	Use:   "rm",
-	Short: "Remove a job from the queue",
-	Long: `Remove a job from the queue based on its ID.
+	Short: "Cancel a job",
+	Long: `Cancel a job based on its ID.
 
-Example:
-  qq job rm 12345`,
+Pending and scheduled jobs are cancelled immediately. Running jobs are only
+cancelled with --force: the worker holding the job sends SIGTERM to the
+command's process group, followed by SIGKILL after a grace period. The final
+state and any partial output are visible with "qq job output".
+
+Examples:
+  qq job rm 12345
+  qq job rm 12345 --force`,
 	Run: func(cmd *cobra.Command, args []string) {
 		if len(args) < 1 {
 			fmt.Println("Error: job ID is required")
@@ -26,38 +39,141 @@ Example:
 		jobID := args[0]
 		force, _ := cmd.Flags().GetBool("force")
 
-		fmt.Printf("Removing job: %s\n", jobID)
-		if force {
-			fmt.Println("Force option enabled, will remove even if job is running")
+		ctx := context.Background()
+
+		// Get database URL
+		dbURL := viper.GetString("db_url")
+		if dbURL == "" {
+			fmt.Println("Database URL is required. Use --db-url flag or set it in the config file.")
+			os.Exit(1)
+		}
+
+		// Connect to the database
+		db, err := database.New(ctx, dbURL)
+		if err != nil {
+			fmt.Printf("Failed to connect to the database: %v\n", err)
+			os.Exit(1)
+		}
+		defer db.Close()
+
+		// Initialize the queue client
+		q, err := queue.NewInsertOnlyClient(ctx, db.Pool)
+		if err != nil {
+			fmt.Printf("Failed to initialize the queue: %v\n", err)
+			os.Exit(1)
+		}
+
+		if err := q.RemoveJob(ctx, jobID, force); err != nil {
+			fmt.Printf("Failed to cancel job: %v\n", err)
+			os.Exit(1)
 		}
 
-		// TODO: Implement job removal functionality
+		if force {
+			fmt.Printf("Cancelled job %s (running commands are sent SIGTERM, then SIGKILL)\n", jobID)
+		} else {
+			fmt.Printf("Cancelled job %s\n", jobID)
+		}
 	},
 }
 
 // queueRmCmd represents the queue rm command
 var queueRmCmd = &cobra.Command{
-	Use:   "rm",
+	Use:   "rm [name]",
 	Short: "Remove a queue",
-	Long: `Remove a queue from the system.
+	Long: `Remove a queue's definition. A queue that still has queued, blocked,
+running or retrying jobs is only removed with --force, which cancels them
+(running commands are sent SIGTERM, then SIGKILL).
+
+Examples:
+  qq queue rm low_priority
+  qq queue rm low_priority --force`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		queueName := args[0]
+		force, _ := cmd.Flags().GetBool("force")
+
+		ctx := context.Background()
+
+		// Get database URL
+		dbURL := viper.GetString("db_url")
+		if dbURL == "" {
+			fmt.Println("Database URL is required. Use --db-url flag or set it in the config file.")
+			os.Exit(1)
+		}
+
+		// Connect to the database
+		db, err := database.New(ctx, dbURL)
+		if err != nil {
+			fmt.Printf("Failed to connect to the database: %v\n", err)
+			os.Exit(1)
+		}
+		defer db.Close()
+
+		// Initialize the queue client
+		q, err := queue.NewInsertOnlyClient(ctx, db.Pool)
+		if err != nil {
+			fmt.Printf("Failed to initialize the queue: %v\n", err)
+			os.Exit(1)
+		}
+
+		cancelled, err := q.RemoveQueue(ctx, queueName, force)
+		if err != nil {
+			fmt.Printf("Failed to remove queue: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Removed queue %s\n", queueName)
+		if cancelled > 0 {
+			fmt.Printf("Cancelled %d unfinished jobs\n", cancelled)
+		}
+	},
+}
+
+// cronRmCmd represents the cron rm command
+var cronRmCmd = &cobra.Command{
+	Use:   "rm [scheduleID]",
+	Short: "Remove a recurring job",
+	Long: `Remove a cron schedule. Jobs it has already enqueued are not affected.
 
 Example:
-  qq queue rm low_priority`,
+  qq cron rm 3`,
+	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		if len(args) < 1 {
-			fmt.Println("Error: queue name is required")
-			return
+		id, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			fmt.Printf("Invalid cron schedule ID: %v\n", err)
+			os.Exit(1)
 		}
 
-		queueName := args[0]
-		force, _ := cmd.Flags().GetBool("force")
+		ctx := context.Background()
 
-		fmt.Printf("Removing queue: %s\n", queueName)
-		if force {
-			fmt.Println("Force option enabled, will remove even if queue has jobs")
+		// Get database URL
+		dbURL := viper.GetString("db_url")
+		if dbURL == "" {
+			fmt.Println("Database URL is required. Use --db-url flag or set it in the config file.")
+			os.Exit(1)
+		}
+
+		// Connect to the database
+		db, err := database.New(ctx, dbURL)
+		if err != nil {
+			fmt.Printf("Failed to connect to the database: %v\n", err)
+			os.Exit(1)
+		}
+		defer db.Close()
+
+		// Initialize the queue client
+		q, err := queue.NewInsertOnlyClient(ctx, db.Pool)
+		if err != nil {
+			fmt.Printf("Failed to initialize the queue: %v\n", err)
+			os.Exit(1)
 		}
 
-		// TODO: Implement queue removal functionality
+		if err := q.RemoveCronSchedule(ctx, id); err != nil {
+			fmt.Printf("Failed to remove cron schedule: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Removed cron schedule %d\n", id)
 	},
 }
 
@@ -68,7 +184,10 @@ func init() {
 	// Add queueRmCmd to the queue command
 	queueCmd.AddCommand(queueRmCmd)
 
+	// Add cronRmCmd to the cron command
+	cronCmd.AddCommand(cronRmCmd)
+
 	// Add flags
-	jobRmCmd.Flags().BoolP("force", "f", false, "Force removal even if job is running")
-	queueRmCmd.Flags().BoolP("force", "f", false, "Force removal even if queue has jobs")
+	jobRmCmd.Flags().BoolP("force", "f", false, "Kill the job's command if it is already running")
+	queueRmCmd.Flags().BoolP("force", "f", false, "Cancel the queue's unfinished jobs and remove it")
 }
@@ -74,8 +74,10 @@ func initConfig() {
 		viper.SetConfigName(".qq")
 	}
 
-	// Explicitly map DATABASE_URL to db_url
+	// Explicitly map DATABASE_URL to db_url, and QQ_API_KEY to the
+	// server's API key
 	viper.BindEnv("db_url", "DATABASE_URL")
+	viper.BindEnv("server.api_key", "QQ_API_KEY")
 	
 	viper.AutomaticEnv() // read in environment variables that match
 
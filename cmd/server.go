@@ -37,9 +37,14 @@ const commonCSS = `
 	.nav a { margin-right: 12px; }
 	.output { background: #1e1e1e; color: #d4d4d4; padding: 16px; border-radius: 4px; overflow-x: auto; white-space: pre-wrap; word-wrap: break-word; font-family: monospace; font-size: 13px; }
 	.status-completed { color: #22863a; font-weight: bold; }
+	.status-succeeded { color: #22863a; font-weight: bold; }
 	.status-running { color: #0366d6; font-weight: bold; }
 	.status-pending { color: #b08800; font-weight: bold; }
+	.status-blocked { color: #6a737d; font-weight: bold; }
+	.status-paused { color: #b08800; font-weight: bold; }
+	.status-lost { color: #cb2431; font-weight: bold; }
 	.status-failed { color: #cb2431; font-weight: bold; }
+	.status-timeout { color: #cb2431; font-weight: bold; font-style: italic; }
 	.meta { margin-bottom: 20px; }
 	.meta dt { font-weight: bold; display: inline; }
 	.meta dd { display: inline; margin-left: 4px; margin-right: 16px; }
@@ -59,18 +64,24 @@ const dashboardTmpl = `<!DOCTYPE html>
 	<table>
 		<tr>
 			<th>Name</th>
+			<th>State</th>
 			<th>Pending</th>
+			<th>Blocked</th>
 			<th>Running</th>
 			<th>Completed</th>
 			<th>Failed</th>
+			<th>Global Limit</th>
 		</tr>
 		{{range .Queues}}
 		<tr>
 			<td><a href="/queue/{{.Name}}">{{.Name}}</a></td>
+			<td>{{if .Paused}}<span class="status-paused">paused</span>{{else}}active{{end}}</td>
 			<td>{{.Pending}}</td>
+			<td>{{.Blocked}}</td>
 			<td>{{.Running}}</td>
 			<td>{{.Completed}}</td>
 			<td>{{.Failed}}</td>
+			<td>{{if .GlobalLimit}}{{.LimitUsed}} / {{.GlobalLimit}}{{else}}-{{end}}</td>
 		</tr>
 		{{end}}
 	</table>
@@ -80,25 +91,51 @@ const dashboardTmpl = `<!DOCTYPE html>
 	<table>
 		<tr>
 			<th>Client ID</th>
+			<th>Host</th>
+			<th>State</th>
 			<th>Queues</th>
 			<th>Jobs Running</th>
 			<th>Jobs Completed</th>
-			<th>Connected Since</th>
+			<th>Started</th>
 			<th>Last Heartbeat</th>
 		</tr>
 		{{range .Workers}}
 		<tr>
 			<td><a href="/workers">{{.ID}}</a></td>
+			<td>{{.Hostname}}</td>
+			<td>{{if .Lost}}<span class="status-lost">lost</span>{{else if .Draining}}<span class="status-paused">draining</span>{{else}}active{{end}}</td>
 			<td>{{.QueueList}}</td>
-			<td>{{.TotalRunning}}</td>
-			<td>{{.TotalCompleted}}</td>
-			<td>{{.CreatedAt}}</td>
-			<td>{{.UpdatedAt}}</td>
+			<td>{{.Running}}</td>
+			<td>{{.JobsCompleted}}</td>
+			<td>{{.StartedAt}}</td>
+			<td>{{.HeartbeatAt}}</td>
+		</tr>
+		{{end}}
+	</table>
+	{{else}}
+	<p>No workers registered.</p>
+	{{end}}
+
+	<h2>Recent Pipelines</h2>
+	{{if .Pipelines}}
+	<table>
+		<tr>
+			<th>Run</th>
+			<th>Name</th>
+			<th>State</th>
+			<th>Submitted</th>
+		</tr>
+		{{range .Pipelines}}
+		<tr>
+			<td><a href="/pipeline/{{.ID}}">{{.ID}}</a></td>
+			<td>{{.Name}}</td>
+			<td><span class="status-{{.State}}">{{.State}}</span></td>
+			<td>{{.Submitted}}</td>
 		</tr>
 		{{end}}
 	</table>
 	{{else}}
-	<p>No active workers connected.</p>
+	<p>No pipelines submitted.</p>
 	{{end}}
 
 	<h2>Recent Jobs</h2>
@@ -115,7 +152,7 @@ const dashboardTmpl = `<!DOCTYPE html>
 			<td><a href="/job/{{.ID}}">{{.ID}}</a></td>
 			<td><a href="/queue/{{.Queue}}">{{.Queue}}</a></td>
 			<td>{{.Command}}</td>
-			<td><span class="status-{{.Status}}">{{.Status}}</span></td>
+			<td><span class="status-{{.Status}}">{{.Status}}</span>{{if .Unroutable}} <span class="status-failed" title="No live worker has labels satisfying the job's requirements">(no matching worker)</span>{{end}}</td>
 			<td>{{.Created}}</td>
 		</tr>
 		{{end}}
@@ -139,19 +176,24 @@ const queueTmpl = `<!DOCTYPE html>
 	<p class="nav"><a href="/">← Dashboard</a> <a href="/queue/{{.QueueName}}">Refresh</a></p>
 
 	{{if .Stats}}
+	{{if .Stats.Paused}}<p class="status-paused">This queue is paused: workers start no new jobs from it until "qq queue resume {{.QueueName}}".</p>{{end}}
 	<h2>Stats</h2>
 	<table>
 		<tr>
 			<th>Pending</th>
+			<th>Blocked</th>
 			<th>Running</th>
 			<th>Completed</th>
 			<th>Failed</th>
+			{{if .Stats.GlobalLimit}}<th>Global Limit</th>{{end}}
 		</tr>
 		<tr>
 			<td>{{.Stats.Pending}}</td>
+			<td>{{.Stats.Blocked}}</td>
 			<td>{{.Stats.Running}}</td>
 			<td>{{.Stats.Completed}}</td>
 			<td>{{.Stats.Failed}}</td>
+			{{if .Stats.GlobalLimit}}<td>{{.Stats.LimitUsed}} / {{.Stats.GlobalLimit}}</td>{{end}}
 		</tr>
 	</table>
 	{{end}}
@@ -160,6 +202,7 @@ const queueTmpl = `<!DOCTYPE html>
 	<div class="filters">
 		<a href="/queue/{{.QueueName}}"{{if eq .StatusFilter ""}} class="active"{{end}}>All</a>
 		<a href="/queue/{{.QueueName}}?status=pending"{{if eq .StatusFilter "pending"}} class="active"{{end}}>Pending</a>
+		<a href="/queue/{{.QueueName}}?status=blocked"{{if eq .StatusFilter "blocked"}} class="active"{{end}}>Blocked</a>
 		<a href="/queue/{{.QueueName}}?status=running"{{if eq .StatusFilter "running"}} class="active"{{end}}>Running</a>
 		<a href="/queue/{{.QueueName}}?status=completed"{{if eq .StatusFilter "completed"}} class="active"{{end}}>Completed</a>
 		<a href="/queue/{{.QueueName}}?status=failed"{{if eq .StatusFilter "failed"}} class="active"{{end}}>Failed</a>
@@ -177,7 +220,7 @@ const queueTmpl = `<!DOCTYPE html>
 		<tr>
 			<td><a href="/job/{{.ID}}">{{.ID}}</a></td>
 			<td>{{.Command}}</td>
-			<td><span class="status-{{.Status}}">{{.Status}}</span></td>
+			<td><span class="status-{{.Status}}">{{.Status}}</span>{{if .Unroutable}} <span class="status-failed" title="No live worker has labels satisfying the job's requirements">(no matching worker)</span>{{end}}</td>
 			<td>{{.ExitCode}}</td>
 			<td>{{.Created}}</td>
 		</tr>
@@ -193,7 +236,13 @@ const jobTmpl = `<!DOCTYPE html>
 <html>
 <head>
 	<title>QQ - Job {{.ID}}</title>
-	<style>` + commonCSS + `</style>
+	{{if eq .Status "running" "pending" "blocked"}}<meta http-equiv="refresh" content="2">{{end}}
+	<style>` + commonCSS + `
+	.legend { font-size: 13px; }
+	.legend span { padding: 2px 6px; background: #1e1e1e; border-radius: 3px; }
+	.stream-stdout { color: #d4d4d4; }
+	.stream-stderr { color: #f48771; }
+	</style>
 </head>
 <body>
 	<h1>Job {{.ID}}</h1>
@@ -204,17 +253,75 @@ const jobTmpl = `<!DOCTYPE html>
 		<dt>Command:</dt><dd><code>{{.Command}}</code></dd>
 		<dt>Status:</dt><dd><span class="status-{{.Status}}">{{.Status}}</span></dd>
 		<dt>Exit Code:</dt><dd>{{.ExitCode}}</dd>
+		{{if .Reason}}<dt>Reason:</dt><dd>{{.Reason}}</dd>{{end}}
 		<dt>Attempt:</dt><dd>{{.Attempt}}</dd>
 		<dt>Created:</dt><dd>{{.Created}}</dd>
 		<dt>Scheduled:</dt><dd>{{.Scheduled}}</dd>
+		{{if .Requires}}<dt>Requires:</dt><dd><code>{{.Requires}}</code></dd>{{end}}
 	</dl>
+	{{if .Unroutable}}<p class="status-failed">No live worker processing queue {{.Queue}} has labels satisfying this job's requirements, so it won't run until one starts.</p>{{end}}
 
 	<h2>Output</h2>
-	{{if .Output}}
+	{{if .Chunks}}
+	<p class="legend"><span class="stream-stdout">stdout</span> <span class="stream-stderr">stderr</span> &middot; hover a line for the time it was written</p>
+	<pre class="output">{{range .Chunks}}<span class="stream-{{.Stream}}" title="{{.Time}}">{{.Data}}</span>{{end}}</pre>
+	{{else if .Output}}
 	<pre class="output">{{.Output}}</pre>
 	{{else}}
 	<p>No output available.</p>
 	{{end}}
+
+	{{if gt (len .Attempts) 1}}
+	<h2>Attempts</h2>
+	{{range .Attempts}}
+	<h3>Attempt {{.Attempt}} &middot; exit code {{.ExitCode}}{{if .Reason}} ({{.Reason}}){{end}} &middot; {{.Created}}</h3>
+	<pre class="output">{{.Output}}</pre>
+	{{end}}
+	{{end}}
+</body>
+</html>`
+
+const pipelineTmpl = `<!DOCTYPE html>
+<html>
+<head>
+	<title>QQ - Pipeline {{.ID}}</title>
+	{{if eq .State "running" "pending"}}<meta http-equiv="refresh" content="2">{{end}}
+	<style>` + commonCSS + `</style>
+</head>
+<body>
+	<h1>Pipeline {{.ID}}: {{.Name}}</h1>
+	<p class="nav"><a href="/">← Dashboard</a> <a href="/pipeline/{{.ID}}">Refresh</a></p>
+
+	<dl class="meta">
+		<dt>State:</dt><dd><span class="status-{{.State}}">{{.State}}</span></dd>
+		<dt>Submitted:</dt><dd>{{.Submitted}}</dd>
+		{{if gt .Attempts 1}}<dt>Attempts:</dt><dd>{{.Attempts}}</dd>{{end}}
+	</dl>
+
+	<h2>Jobs</h2>
+	<table>
+		<tr>
+			<th>Name</th>
+			<th>Job</th>
+			<th>Queue</th>
+			<th>Status</th>
+			<th>Exit Code</th>
+			<th>Reason</th>
+		</tr>
+		{{range .Jobs}}
+		<tr>
+			<td>{{.Name}}</td>
+			<td><a href="/job/{{.ID}}">{{.ID}}</a></td>
+			<td>{{.Queue}}</td>
+			<td><span class="status-{{.Status}}">{{.Status}}</span></td>
+			<td>{{.ExitCode}}</td>
+			<td>{{.Reason}}</td>
+		</tr>
+		{{end}}
+	</table>
+
+	<h2>Source</h2>
+	<pre class="output">{{.Source}}</pre>
 </body>
 </html>`
 
@@ -230,43 +337,52 @@ const workersTmpl = `<!DOCTYPE html>
 
 	{{if .Workers}}
 	{{range .Workers}}
-	<h2>{{.ID}}</h2>
+	<h2>{{.ID}}{{if .Lost}} <span class="status-lost">lost</span>{{else if .Draining}} <span class="status-paused">draining</span>{{end}}</h2>
 	<dl class="meta">
-		<dt>Connected Since:</dt><dd>{{.CreatedAt}}</dd>
-		<dt>Last Heartbeat:</dt><dd>{{.UpdatedAt}}</dd>
+		<dt>Host:</dt><dd>{{.Hostname}}</dd>
+		<dt>PID:</dt><dd>{{.PID}}</dd>
+		<dt>Version:</dt><dd>{{.Version}}</dd>
+		{{if .Labels}}<dt>Labels:</dt><dd>{{range $key, $value := .Labels}}<code>{{$key}}={{$value}}</code> {{end}}</dd>{{end}}
+		<dt>Started:</dt><dd>{{.StartedAt.Format "2006-01-02T15:04:05Z07:00"}}</dd>
+		<dt>Last Heartbeat:</dt><dd>{{.HeartbeatAt.Format "2006-01-02T15:04:05Z07:00"}}</dd>
+		<dt>Jobs Completed:</dt><dd>{{.JobsCompleted}}</dd>
 	</dl>
+	{{if .Lost}}<p class="status-lost">This worker stopped sending heartbeats without shutting down. Its running jobs are rescued once River considers them stuck.</p>{{end}}
 
-	{{if .Queues}}
 	<table>
 		<tr>
 			<th>Queue</th>
 			<th>Max Workers</th>
 			<th>Jobs Running</th>
-			<th>Jobs Completed</th>
 		</tr>
 		{{range .Queues}}
 		<tr>
 			<td><a href="/queue/{{.Name}}">{{.Name}}</a></td>
 			<td>{{.MaxWorkers}}</td>
 			<td>{{.NumJobsRunning}}</td>
-			<td>{{.NumJobsCompleted}}</td>
 		</tr>
 		{{end}}
 	</table>
-	{{else}}
-	<p>No queues registered.</p>
+	{{if .RunningJobIDs}}
+	<p>Running jobs: {{range $i, $id := .RunningJobIDs}}{{if $i}}, {{end}}<a href="/job/{{$id}}">{{$id}}</a>{{end}}</p>
 	{{end}}
 	{{end}}
 	{{else}}
-	<p>No active workers connected.</p>
+	<p>No workers registered.</p>
 	{{end}}
 </body>
 </html>`
 
-func mapJobStatus(state string) string {
+func mapJobStatus(state, reason string) string {
+	if reason == queue.ReasonTimeout && (state == "discarded" || state == "cancelled") {
+		return "timeout"
+	}
 	switch state {
 	case "available", "scheduled", "retryable":
 		return "pending"
+	case "pending":
+		// River's pending state holds jobs waiting for dependencies
+		return "blocked"
 	case "running":
 		return "running"
 	case "completed":
@@ -286,7 +402,17 @@ var serverCmd = &cobra.Command{
 of the queue, including active, pending, and completed jobs.
 
 The server connects to the same Postgres database as the workers
-to provide real-time information about the queue status.`,
+to provide real-time information about the queue status.
+
+Prometheus metrics are served at /metrics: jobs per queue and state
+(including jobs blocked by dependencies), the duration and failure ratio
+of jobs finished in the last hour, and each worker's heartbeat age.
+
+With an API key (QQ_API_KEY or server.api_key), the server also exposes a
+JSON API under /api/v1 to submit jobs and pipelines, list, inspect, cancel
+and retry jobs, and read queue stats and workers. Requests authenticate
+with "Authorization: Bearer <key>". The OpenAPI document describing the API
+is served at /api/v1/openapi.yaml.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		addr, _ := cmd.Flags().GetString("addr")
 		fmt.Printf("Starting server on %s...\n", addr)
@@ -305,7 +431,7 @@ to provide real-time information about the queue status.`,
 		}()
 
 		// Load configuration
-		_, err := config.LoadConfig()
+		cfg, err := config.LoadConfig()
 		if err != nil {
 			fmt.Printf("Failed to load configuration: %v\n", err)
 			os.Exit(1)
@@ -358,6 +484,7 @@ to provide real-time information about the queue status.`,
 				queueStats = append(queueStats, queue.QueueStats{
 					Name:      "default",
 					Pending:   0,
+					Blocked:   0,
 					Running:   0,
 					Completed: 0,
 					Failed:    0,
@@ -377,61 +504,90 @@ to provide real-time information about the queue status.`,
 			}
 
 			type templateWorker struct {
-				ID             string
-				QueueList      string
-				TotalRunning   int
-				TotalCompleted int
-				CreatedAt      string
-				UpdatedAt      string
+				ID            string
+				Hostname      string
+				QueueList     string
+				Running       int
+				JobsCompleted int64
+				StartedAt     string
+				HeartbeatAt   string
+				Lost          bool
+				Draining      bool
 			}
 
 			var templateWorkers []templateWorker
 			for _, wr := range workers {
 				var queueNames []string
-				totalRunning := 0
-				totalCompleted := 0
 				for _, q := range wr.Queues {
 					queueNames = append(queueNames, q.Name)
-					totalRunning += q.NumJobsRunning
-					totalCompleted += q.NumJobsCompleted
 				}
 				templateWorkers = append(templateWorkers, templateWorker{
-					ID:             wr.ID,
-					QueueList:      strings.Join(queueNames, ", "),
-					TotalRunning:   totalRunning,
-					TotalCompleted: totalCompleted,
-					CreatedAt:      wr.CreatedAt.Format(time.RFC3339),
-					UpdatedAt:      wr.UpdatedAt.Format(time.RFC3339),
+					ID:            wr.ID,
+					Hostname:      wr.Hostname,
+					QueueList:     strings.Join(queueNames, ", "),
+					Running:       len(wr.RunningJobIDs),
+					JobsCompleted: wr.JobsCompleted,
+					StartedAt:     wr.StartedAt.Format(time.RFC3339),
+					HeartbeatAt:   wr.HeartbeatAt.Format(time.RFC3339),
+					Lost:          wr.Lost,
+					Draining:      wr.Draining,
+				})
+			}
+
+			runs, err := queueClient.ListPipelineRuns(ctx, 10)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to list pipeline runs: %v", err), http.StatusInternalServerError)
+				return
+			}
+
+			type templatePipeline struct {
+				ID        int64
+				Name      string
+				State     string
+				Submitted string
+			}
+
+			var templatePipelines []templatePipeline
+			for _, run := range runs {
+				templatePipelines = append(templatePipelines, templatePipeline{
+					ID:        run.ID,
+					Name:      run.Name,
+					State:     run.State,
+					Submitted: run.SubmittedAt.Format(time.RFC3339),
 				})
 			}
 
 			type templateJob struct {
-				ID      string
-				Queue   string
-				Command string
-				Status  string
-				Created string
+				ID         string
+				Queue      string
+				Command    string
+				Status     string
+				Created    string
+				Unroutable bool
 			}
 
 			var templateJobs []templateJob
 			for _, job := range jobs {
 				templateJobs = append(templateJobs, templateJob{
-					ID:      fmt.Sprintf("%d", job.ID),
-					Queue:   job.Queue,
-					Command: job.Command,
-					Status:  mapJobStatus(job.State),
-					Created: job.CreatedAt.Format(time.RFC3339),
+					ID:         fmt.Sprintf("%d", job.ID),
+					Queue:      job.Queue,
+					Command:    job.Command,
+					Status:     mapJobStatus(job.State, job.Reason),
+					Created:    job.CreatedAt.Format(time.RFC3339),
+					Unroutable: job.Unroutable,
 				})
 			}
 
 			data := struct {
-				Queues  []queue.QueueStats
-				Workers []templateWorker
-				Jobs    []templateJob
+				Queues    []queue.QueueStats
+				Workers   []templateWorker
+				Pipelines []templatePipeline
+				Jobs      []templateJob
 			}{
-				Queues:  queueStats,
-				Workers: templateWorkers,
-				Jobs:    templateJobs,
+				Queues:    queueStats,
+				Workers:   templateWorkers,
+				Pipelines: templatePipelines,
+				Jobs:      templateJobs,
 			}
 
 			t, err := template.New("dashboard").Parse(dashboardTmpl)
@@ -456,7 +612,7 @@ to provide real-time information about the queue status.`,
 
 			statusFilter := r.URL.Query().Get("status")
 			switch statusFilter {
-			case "", "pending", "running", "completed", "failed":
+			case "", "pending", "blocked", "running", "completed", "failed":
 				// valid
 			default:
 				statusFilter = ""
@@ -480,21 +636,23 @@ to provide real-time information about the queue status.`,
 			}
 
 			type templateJob struct {
-				ID       string
-				Command  string
-				Status   string
-				ExitCode int
-				Created  string
+				ID         string
+				Command    string
+				Status     string
+				ExitCode   int
+				Created    string
+				Unroutable bool
 			}
 
 			var templateJobs []templateJob
 			for _, job := range jobs {
 				templateJobs = append(templateJobs, templateJob{
-					ID:       fmt.Sprintf("%d", job.ID),
-					Command:  job.Command,
-					Status:   mapJobStatus(job.State),
-					ExitCode: job.ExitCode,
-					Created:  job.CreatedAt.Format(time.RFC3339),
+					ID:         fmt.Sprintf("%d", job.ID),
+					Command:    job.Command,
+					Status:     mapJobStatus(job.State, job.Reason),
+					ExitCode:   job.ExitCode,
+					Created:    job.CreatedAt.Format(time.RFC3339),
+					Unroutable: job.Unroutable,
 				})
 			}
 
@@ -530,42 +688,10 @@ to provide real-time information about the queue status.`,
 				return
 			}
 
-			type templateQueueInfo struct {
-				Name             string
-				MaxWorkers       int
-				NumJobsRunning   int
-				NumJobsCompleted int
-			}
-
-			type templateWorker struct {
-				ID        string
-				CreatedAt string
-				UpdatedAt string
-				Queues    []templateQueueInfo
-			}
-
-			var templateWorkers []templateWorker
-			for _, wr := range workers {
-				tw := templateWorker{
-					ID:        wr.ID,
-					CreatedAt: wr.CreatedAt.Format(time.RFC3339),
-					UpdatedAt: wr.UpdatedAt.Format(time.RFC3339),
-				}
-				for _, q := range wr.Queues {
-					tw.Queues = append(tw.Queues, templateQueueInfo{
-						Name:             q.Name,
-						MaxWorkers:       q.MaxWorkers,
-						NumJobsRunning:   q.NumJobsRunning,
-						NumJobsCompleted: q.NumJobsCompleted,
-					})
-				}
-				templateWorkers = append(templateWorkers, tw)
-			}
-
 			data := struct {
-				Workers []templateWorker
+				Workers []queue.WorkerInfo
 			}{
-				Workers: templateWorkers,
+				Workers: workers,
 			}
 
 			t, err := template.New("workers").Parse(workersTmpl)
@@ -595,26 +721,82 @@ to provide real-time information about the queue status.`,
 				return
 			}
 
+			attempts, err := queueClient.GetJobAttempts(ctx, jobID)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to get job attempts: %v", err), http.StatusInternalServerError)
+				return
+			}
+
+			type templateAttempt struct {
+				Attempt  int
+				ExitCode int
+				Reason   string
+				Created  string
+				Output   string
+			}
+
+			var templateAttempts []templateAttempt
+			for _, a := range attempts {
+				templateAttempts = append(templateAttempts, templateAttempt{
+					Attempt:  a.Attempt,
+					ExitCode: a.ExitCode,
+					Reason:   a.Reason,
+					Created:  a.CreatedAt.Format(time.RFC3339),
+					Output:   a.Output,
+				})
+			}
+
+			chunks, err := queueClient.GetOutputChunks(ctx, jobID, job.Attempt, 0)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to get job output: %v", err), http.StatusInternalServerError)
+				return
+			}
+
+			type templateChunk struct {
+				Stream string
+				Time   string
+				Data   string
+			}
+
+			var templateChunks []templateChunk
+			for _, c := range chunks {
+				templateChunks = append(templateChunks, templateChunk{
+					Stream: c.Stream,
+					Time:   c.CreatedAt.Format("2006-01-02T15:04:05.000Z07:00"),
+					Data:   c.Data,
+				})
+			}
+
 			data := struct {
-				ID        string
-				Queue     string
-				Command   string
-				Status    string
-				ExitCode  int
-				Attempt   int
-				Created   string
-				Scheduled string
-				Output    string
+				ID         string
+				Queue      string
+				Command    string
+				Status     string
+				ExitCode   int
+				Reason     string
+				Attempt    int
+				Created    string
+				Scheduled  string
+				Requires   string
+				Unroutable bool
+				Output     string
+				Chunks     []templateChunk
+				Attempts   []templateAttempt
 			}{
-				ID:        fmt.Sprintf("%d", job.ID),
-				Queue:     job.Queue,
-				Command:   job.Command,
-				Status:    mapJobStatus(job.State),
-				ExitCode:  job.ExitCode,
-				Attempt:   job.Attempt,
-				Created:   job.CreatedAt.Format(time.RFC3339),
-				Scheduled: job.ScheduledAt.Format(time.RFC3339),
-				Output:    job.Output,
+				ID:         fmt.Sprintf("%d", job.ID),
+				Queue:      job.Queue,
+				Command:    job.Command,
+				Status:     mapJobStatus(job.State, job.Reason),
+				ExitCode:   job.ExitCode,
+				Reason:     job.Reason,
+				Attempt:    job.Attempt,
+				Created:    job.CreatedAt.Format(time.RFC3339),
+				Scheduled:  job.ScheduledAt.Format(time.RFC3339),
+				Requires:   strings.Join(job.Requires, ", "),
+				Unroutable: job.Unroutable,
+				Output:     job.Output,
+				Chunks:     templateChunks,
+				Attempts:   templateAttempts,
 			}
 
 			t, err := template.New("job").Parse(jobTmpl)
@@ -629,6 +811,83 @@ to provide real-time information about the queue status.`,
 			}
 		})
 
+		// Pipeline run handler: /pipeline/{id}
+		mux.HandleFunc("/pipeline/", func(w http.ResponseWriter, r *http.Request) {
+			idStr := strings.TrimPrefix(r.URL.Path, "/pipeline/")
+			runID, err := strconv.ParseInt(idStr, 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid pipeline run ID", http.StatusBadRequest)
+				return
+			}
+
+			run, err := queueClient.GetPipelineRun(ctx, runID)
+			if err != nil {
+				http.Error(w, "Pipeline run not found", http.StatusNotFound)
+				return
+			}
+
+			type templateJob struct {
+				Name     string
+				ID       int64
+				Queue    string
+				Status   string
+				ExitCode int
+				Reason   string
+			}
+
+			var templateJobs []templateJob
+			for _, job := range run.Jobs {
+				templateJobs = append(templateJobs, templateJob{
+					Name:     job.Name,
+					ID:       job.JobID,
+					Queue:    job.Queue,
+					Status:   mapJobStatus(job.State, job.Reason),
+					ExitCode: job.ExitCode,
+					Reason:   job.Reason,
+				})
+			}
+
+			data := struct {
+				ID        int64
+				Name      string
+				State     string
+				Submitted string
+				Attempts  int
+				Source    string
+				Jobs      []templateJob
+			}{
+				ID:        run.ID,
+				Name:      run.Name,
+				State:     run.State,
+				Submitted: run.SubmittedAt.Format(time.RFC3339),
+				Attempts:  run.Attempts,
+				Source:    run.Source,
+				Jobs:      templateJobs,
+			}
+
+			t, err := template.New("pipeline").Parse(pipelineTmpl)
+			if err != nil {
+				http.Error(w, "Template error", http.StatusInternalServerError)
+				return
+			}
+
+			if err := t.Execute(w, data); err != nil {
+				http.Error(w, "Template execution error", http.StatusInternalServerError)
+				return
+			}
+		})
+
+		// Prometheus metrics, queried from the database on every scrape
+		mux.Handle("/metrics", queueClient.QueueMetricsHandler())
+
+		// JSON API, only served with an API key since it can run commands
+		// on the workers
+		if cfg.Server.APIKey != "" {
+			mux.Handle("/api/v1/", newAPIHandler(ctx, queueClient, cfg.Server.APIKey))
+		} else {
+			fmt.Println("JSON API disabled (set QQ_API_KEY or server.api_key to enable it)")
+		}
+
 		// Start HTTP server
 		server := &http.Server{
 			Addr:    addr,
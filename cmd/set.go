@@ -0,0 +1,108 @@
+/*
+Copyright © 2025 Will Atlas <will@atls.dev>
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"qq/pkg/database"
+	"qq/pkg/queue"
+)
+
+// queueSetCmd represents the queue set command
+var queueSetCmd = &cobra.Command{
+	Use:   "set [name]",
+	Short: "Change a queue's settings",
+	Long: `Change the settings of a queue, adding the queue if it doesn't exist.
+Settings without a flag keep their value.
+
+--global-limit caps the jobs of the queue running at once across all
+workers, e.g. to protect a rate-limited service. Workers check it before
+starting each job, so a new limit applies right away; jobs over it wait in
+the queue. 0 removes the limit. The other settings apply once the workers
+processing the queue restart.
+
+Examples:
+  qq queue set notifications --global-limit 5
+  qq queue set ci --max-workers 2 --timeout 30m`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		queueName := args[0]
+		ctx := context.Background()
+
+		// Get database URL
+		dbURL := viper.GetString("db_url")
+		if dbURL == "" {
+			fmt.Println("Database URL is required. Use --db-url flag or set it in the config file.")
+			os.Exit(1)
+		}
+
+		// Connect to the database
+		db, err := database.New(ctx, dbURL)
+		if err != nil {
+			fmt.Printf("Failed to connect to the database: %v\n", err)
+			os.Exit(1)
+		}
+		defer db.Close()
+
+		// Initialize the queue client
+		q, err := queue.NewInsertOnlyClient(ctx, db.Pool)
+		if err != nil {
+			fmt.Printf("Failed to initialize the queue: %v\n", err)
+			os.Exit(1)
+		}
+
+		queueConfig, err := q.GetQueueConfig(ctx, queueName)
+		if err != nil {
+			fmt.Printf("Failed to get queue: %v\n", err)
+			os.Exit(1)
+		}
+		if queueConfig == nil {
+			queueConfig = &queue.QueueConfig{Name: queueName}
+		}
+
+		if cmd.Flags().Changed("max-workers") {
+			queueConfig.MaxWorkers, _ = cmd.Flags().GetInt("max-workers")
+		}
+		if cmd.Flags().Changed("timeout") {
+			queueConfig.DefaultTimeout, _ = cmd.Flags().GetDuration("timeout")
+		}
+		if cmd.Flags().Changed("priority") {
+			queueConfig.DefaultPriority, _ = cmd.Flags().GetInt("priority")
+		}
+		if cmd.Flags().Changed("description") {
+			queueConfig.Description, _ = cmd.Flags().GetString("description")
+		}
+		if cmd.Flags().Changed("global-limit") {
+			queueConfig.GlobalLimit, _ = cmd.Flags().GetInt("global-limit")
+		}
+
+		if err := q.SetQueueConfig(ctx, queueConfig); err != nil {
+			fmt.Printf("Failed to set queue: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Updated queue %s\n", queueName)
+		if queueConfig.GlobalLimit > 0 {
+			fmt.Printf("Global limit: %d running jobs across all workers\n", queueConfig.GlobalLimit)
+		} else {
+			fmt.Println("Global limit: none")
+		}
+	},
+}
+
+func init() {
+	queueCmd.AddCommand(queueSetCmd)
+
+	queueSetCmd.Flags().Int("global-limit", 0, "Jobs of the queue running at once across all workers (0 = no limit)")
+	queueSetCmd.Flags().IntP("max-workers", "m", 0, "Jobs a worker runs at once from this queue (0 = the worker's --concurrency)")
+	queueSetCmd.Flags().Duration("timeout", 0, "Timeout for the queue's jobs that set none (0 = none)")
+	queueSetCmd.Flags().IntP("priority", "p", 0, "Priority of jobs added to the queue without --priority (1-4, 0 = none)")
+	queueSetCmd.Flags().String("description", "", "What the queue is for")
+}
@@ -0,0 +1,87 @@
+/*
+Copyright © 2025 Will Atlas <will@atls.dev>
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"qq/pkg/database"
+	"qq/pkg/queue"
+)
+
+// pipelineStatusCmd represents the pipeline status command
+var pipelineStatusCmd = &cobra.Command{
+	Use:   "status [runID]",
+	Short: "Show the status of a pipeline run",
+	Long: `Show the overall state of a pipeline run and the state of each of its jobs.
+
+Examples:
+  qq pipeline status 12`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runID, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			fmt.Printf("Invalid pipeline run ID: %v\n", err)
+			os.Exit(1)
+		}
+
+		ctx := context.Background()
+
+		// Get database URL from config
+		dbURL := viper.GetString("db_url")
+		if dbURL == "" {
+			fmt.Println("Database URL is required. Use --db-url flag or set it in the config file.")
+			os.Exit(1)
+		}
+
+		// Connect to the database
+		db, err := database.New(ctx, dbURL)
+		if err != nil {
+			fmt.Printf("Failed to connect to the database: %v\n", err)
+			os.Exit(1)
+		}
+		defer db.Close()
+
+		// Initialize the queue client
+		q, err := queue.NewInsertOnlyClient(ctx, db.Pool)
+		if err != nil {
+			fmt.Printf("Failed to initialize the queue: %v\n", err)
+			os.Exit(1)
+		}
+
+		run, err := q.GetPipelineRun(ctx, runID)
+		if err != nil {
+			fmt.Printf("Failed to get pipeline run: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Pipeline run %d: %s\n", run.ID, run.Name)
+		if run.RunKey != "" {
+			fmt.Printf("Run key: %s\n", run.RunKey)
+		}
+		fmt.Printf("Submitted: %s\n", run.SubmittedAt.Format(time.RFC3339))
+		fmt.Printf("State: %s\n", run.State)
+		if run.Attempts > 1 {
+			fmt.Printf("Attempts: %d (retried with \"qq pipeline retry\")\n", run.Attempts)
+		}
+
+		fmt.Printf("\n%-20s %-10s %-15s %-10s %-9s %s\n", "NAME", "JOB ID", "QUEUE", "STATUS", "EXIT CODE", "REASON")
+		fmt.Printf("%-20s %-10s %-15s %-10s %-9s %s\n", "----", "------", "-----", "------", "---------", "------")
+		for _, job := range run.Jobs {
+			fmt.Printf("%-20s %-10d %-15s %-10s %-9d %s\n",
+				job.Name, job.JobID, job.Queue, mapJobStatus(job.State, job.Reason), job.ExitCode, job.Reason)
+		}
+	},
+}
+
+func init() {
+	pipelineCmd.AddCommand(pipelineStatusCmd)
+}
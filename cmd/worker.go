@@ -6,10 +6,13 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"sort"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -27,22 +30,39 @@ var workerCmd = &cobra.Command{
 on the queue and executes them.
 
 Workers connect to the Postgres database specified in the configuration
-and process jobs based on their priority and scheduled time.`,
+and process jobs based on their priority and scheduled time.
+
+Each queue runs up to --concurrency jobs at once, unless the queue sets its
+own concurrency with --queue name=N (or worker.queues in the config file)
+or was added with "qq queue add --max-workers". --total-concurrency caps
+the jobs running at once across all queues.
+
+On SIGINT or SIGTERM, or when asked with "qq worker drain", the worker
+drains: it starts no new jobs and gives running jobs --shutdown-timeout to
+finish. Jobs still running then are killed like timed out jobs and go back
+to their queue for another worker. A second signal does so right away.
+
+Workers can describe their host with labels (--label or worker.labels in
+the config file). A job added with requirements, e.g. "qq job add
+--requires gpu", only runs on a worker whose labels satisfy them.
+
+With --metrics-addr (or worker.metrics_addr), the worker serves Prometheus
+metrics of the jobs it runs at /metrics: run time histograms, exit code
+counts and output sizes.
+
+Example:
+  qq worker --queue default,ci=2,notifications=20 --total-concurrency 16
+  qq worker --queue builds --label os=linux --label gpu=a100
+  qq worker --metrics-addr :9101`,
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Println("Starting worker...")
 
-		// Create a context that's canceled when SIGINT or SIGTERM is received
-		ctx, cancel := context.WithCancel(context.Background())
-		defer cancel()
-
-		// Set up a channel to listen for OS signals
+		// The worker runs until it gets SIGINT or SIGTERM, or is asked to
+		// drain with "qq worker drain". Running jobs are not tied to ctx, so
+		// that they can finish while the worker drains.
+		ctx := context.Background()
 		sigCh := make(chan os.Signal, 1)
 		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-		go func() {
-			<-sigCh
-			fmt.Println("\nShutting down worker...")
-			cancel()
-		}()
 
 		// Load configuration
 		cfg, err := config.LoadConfig()
@@ -71,8 +91,35 @@ and process jobs based on their priority and scheduled time.`,
 
 		queueFlag, _ := cmd.Flags().GetString("queue")
 		if queueFlag != "" {
-			// Support comma-separated queue names: --queue=default,high-priority
-			cfg.Worker.Queues = strings.Split(queueFlag, ",")
+			// Support comma-separated queue names with optional concurrency:
+			// --queue=default,ci=2
+			queues, queueConcurrency, err := config.ParseQueues(strings.Split(queueFlag, ","))
+			if err != nil {
+				fmt.Printf("Invalid --queue: %v\n", err)
+				os.Exit(1)
+			}
+			cfg.Worker.Queues = queues
+			cfg.Worker.QueueConcurrency = queueConcurrency
+		}
+
+		labelFlags, _ := cmd.Flags().GetStringArray("label")
+		if len(labelFlags) > 0 {
+			labels, err := config.ParseLabels(labelFlags)
+			if err != nil {
+				fmt.Printf("Invalid --label: %v\n", err)
+				os.Exit(1)
+			}
+			if cfg.Worker.Labels == nil {
+				cfg.Worker.Labels = make(map[string]string, len(labels))
+			}
+			for key, value := range labels {
+				cfg.Worker.Labels[key] = value
+			}
+		}
+
+		totalConcurrency, _ := cmd.Flags().GetInt("total-concurrency")
+		if totalConcurrency > 0 {
+			cfg.Worker.TotalConcurrency = totalConcurrency
 		}
 
 		interval, _ := cmd.Flags().GetDuration("interval")
@@ -80,6 +127,28 @@ and process jobs based on their priority and scheduled time.`,
 			cfg.Worker.Interval = int(interval.Seconds())
 		}
 
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+		if timeout > 0 {
+			cfg.Worker.Timeout = timeout
+		}
+
+		killGrace, _ := cmd.Flags().GetDuration("kill-grace")
+
+		shutdownTimeout := cfg.Worker.ShutdownTimeout
+		if cmd.Flags().Changed("shutdown-timeout") {
+			shutdownTimeout, _ = cmd.Flags().GetDuration("shutdown-timeout")
+		}
+
+		metricsAddr, _ := cmd.Flags().GetString("metrics-addr")
+		if metricsAddr != "" {
+			cfg.Worker.MetricsAddr = metricsAddr
+		}
+
+		envAllowlist, _ := cmd.Flags().GetString("env-allowlist")
+		if envAllowlist != "" {
+			cfg.Worker.EnvAllowlist = strings.Split(envAllowlist, ",")
+		}
+
 		// Connect to the database
 		fmt.Println("Connecting to the database...")
 		db, err := database.New(ctx, dbURL)
@@ -92,33 +161,88 @@ and process jobs based on their priority and scheduled time.`,
 		// Initialize the queue client
 		fmt.Println("Initializing the queue...")
 		q, err := queue.NewQueueClient(ctx, db.Pool, &queue.WorkerConfig{
-			Concurrency: cfg.Worker.Concurrency,
-			ID:          cfg.Worker.ID,
-			Queues:      cfg.Worker.Queues,
+			Concurrency:     cfg.Worker.Concurrency,
+			ID:              cfg.Worker.ID,
+			Queues:          cfg.Worker.Queues,
+			KillGracePeriod: killGrace,
+			DefaultTimeout:  cfg.Worker.Timeout,
+			QueueTimeouts:   cfg.Worker.Timeouts,
+			EnvAllowlist:    cfg.Worker.EnvAllowlist,
+
+			QueueConcurrency: cfg.Worker.QueueConcurrency,
+			TotalConcurrency: cfg.Worker.TotalConcurrency,
+			Version:          Version,
+			Labels:           cfg.Worker.Labels,
 		})
 		if err != nil {
 			fmt.Printf("Failed to initialize the queue: %v\n", err)
 			os.Exit(1)
 		}
-		defer func() {
-			if err := q.Close(context.Background()); err != nil {
-				fmt.Printf("Failed to close the queue: %v\n", err)
-			}
-		}()
 
-		if cfg.Worker.ID != "" {
-			fmt.Printf("Worker ID: %s\n", cfg.Worker.ID)
-		}
+		fmt.Printf("Worker ID: %s\n", q.Client().ID())
 		fmt.Printf("Worker is running with concurrency %d\n", cfg.Worker.Concurrency)
+		if len(cfg.Worker.Labels) > 0 {
+			fmt.Printf("Labels: %s\n", formatLabels(cfg.Worker.Labels))
+		}
+		if cfg.Worker.TotalConcurrency > 0 {
+			fmt.Printf("Running at most %d jobs across all queues\n", cfg.Worker.TotalConcurrency)
+		}
 		if len(cfg.Worker.Queues) > 0 {
-			fmt.Printf("Processing queues: %s\n", strings.Join(cfg.Worker.Queues, ", "))
+			names := make([]string, len(cfg.Worker.Queues))
+			for i, name := range cfg.Worker.Queues {
+				names[i] = name
+				if n, ok := cfg.Worker.QueueConcurrency[name]; ok {
+					names[i] = fmt.Sprintf("%s (concurrency %d)", name, n)
+				}
+			}
+			fmt.Printf("Processing queues: %s\n", strings.Join(names, ", "))
 		} else {
 			fmt.Println("Processing queue: default")
 		}
 
+		if cfg.Worker.MetricsAddr != "" {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", q.WorkerMetricsHandler())
+			metricsServer := &http.Server{
+				Addr:    cfg.Worker.MetricsAddr,
+				Handler: mux,
+			}
+			go func() {
+				if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					fmt.Printf("Metrics server error: %v\n", err)
+				}
+			}()
+			defer metricsServer.Close()
+			fmt.Printf("Serving metrics on http://%s/metrics\n", cfg.Worker.MetricsAddr)
+		}
+
 		// River Queue manages workers internally, so we just need to wait
-		// for the context to be canceled
-		<-ctx.Done()
+		// for a signal or a drain request
+		select {
+		case <-sigCh:
+			fmt.Println("\nShutting down worker...")
+		case <-q.DrainRequested():
+			fmt.Println("Worker was asked to drain, shutting down...")
+		}
+
+		// Drain: start no new jobs and let running ones finish. Another
+		// signal cancels the running jobs right away.
+		fmt.Printf("Waiting up to %s for running jobs to finish (signal again to cancel them now)\n", shutdownTimeout)
+		shutdownCtx, forceStop := context.WithCancel(context.Background())
+		defer forceStop()
+		go func() {
+			select {
+			case <-sigCh:
+				fmt.Println("Cancelling running jobs...")
+				forceStop()
+			case <-shutdownCtx.Done():
+			}
+		}()
+		if err := q.Shutdown(shutdownCtx, shutdownTimeout); err != nil {
+			fmt.Printf("Failed to stop the worker cleanly: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("Worker stopped")
 	},
 }
 
@@ -128,6 +252,23 @@ func init() {
 	// Add flags specific to the worker command
 	workerCmd.Flags().IntP("concurrency", "c", 1, "Number of jobs to process concurrently")
 	workerCmd.Flags().String("id", "", "Worker ID for identifying this worker instance (must be unique, max 100 chars)")
-	workerCmd.Flags().StringP("queue", "q", "", "Comma-separated list of queues to process (default: default)")
+	workerCmd.Flags().StringP("queue", "q", "", "Comma-separated list of queues to process, each optionally with its own concurrency, e.g. ci=2,notifications=20 (default: default)")
+	workerCmd.Flags().Int("total-concurrency", 0, "Maximum number of jobs to process concurrently across all queues (0 = no limit)")
 	workerCmd.Flags().DurationP("interval", "i", 0, "Polling interval for checking new jobs")
+	workerCmd.Flags().Duration("timeout", 0, "Default timeout for jobs that set none and whose queue has no worker.timeouts entry (0 = no timeout)")
+	workerCmd.Flags().String("env-allowlist", "", "Comma-separated environment variables jobs inherit from the worker (default: all)")
+	workerCmd.Flags().Duration("kill-grace", 10*time.Second, "Time a killed job gets to exit after SIGTERM before SIGKILL")
+	workerCmd.Flags().StringArray("label", nil, "Label describing this worker for jobs' --requires, e.g. os=linux (repeatable)")
+	workerCmd.Flags().String("metrics-addr", "", "Address to serve Prometheus metrics on (host:port), e.g. :9101 (default: no metrics)")
+	workerCmd.Flags().Duration("shutdown-timeout", time.Minute, "Time running jobs get to finish when the worker stops before they are cancelled and requeued")
+}
+
+// formatLabels renders worker labels as sorted key=value pairs
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ", ")
 }
@@ -1,6 +1,11 @@
 package config
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/spf13/viper"
 )
 
@@ -18,15 +23,36 @@ type DatabaseConfig struct {
 
 // WorkerConfig holds worker settings
 type WorkerConfig struct {
-	ID          string
-	Concurrency int
-	Queues      []string
-	Interval    int // in seconds
+	ID           string
+	Concurrency  int
+	Queues       []string
+	Interval     int // in seconds
+	Timeout      time.Duration
+	Timeouts     map[string]time.Duration // per-queue default job timeouts
+	EnvAllowlist []string                 // worker variables jobs inherit (empty = all)
+
+	// QueueConcurrency overrides Concurrency for individual queues, and
+	// TotalConcurrency caps the jobs running at once across all queues
+	// (0 = no cap)
+	QueueConcurrency map[string]int
+	TotalConcurrency int
+
+	// ShutdownTimeout is how long running jobs get to finish when the
+	// worker stops
+	ShutdownTimeout time.Duration
+
+	// Labels describe the worker's host for jobs' requirements, e.g.
+	// worker.labels: {os: linux, disk: ssd}
+	Labels map[string]string
+
+	// MetricsAddr is where the worker serves Prometheus metrics, if set
+	MetricsAddr string
 }
 
 // ServerConfig holds server settings
 type ServerConfig struct {
 	Address string
+	APIKey  string // bearer token of the JSON API, which is off without one
 }
 
 // LoadConfig loads the application configuration from viper
@@ -36,16 +62,29 @@ func LoadConfig() (*Config, error) {
 			URL: viper.GetString("db_url"),
 		},
 		Worker: WorkerConfig{
-			ID:          viper.GetString("worker.id"),
-			Concurrency: viper.GetInt("worker.concurrency"),
-			Queues:      viper.GetStringSlice("worker.queues"),
-			Interval:    viper.GetInt("worker.interval"),
+			ID:           viper.GetString("worker.id"),
+			Concurrency:  viper.GetInt("worker.concurrency"),
+			Interval:     viper.GetInt("worker.interval"),
+			Timeout:      viper.GetDuration("worker.timeout"),
+			EnvAllowlist: viper.GetStringSlice("worker.env_allowlist"),
+
+			TotalConcurrency: viper.GetInt("worker.total_concurrency"),
+			ShutdownTimeout:  time.Minute,
+			MetricsAddr:      viper.GetString("worker.metrics_addr"),
 		},
 		Server: ServerConfig{
 			Address: viper.GetString("server.address"),
+			APIKey:  viper.GetString("server.api_key"),
 		},
 	}
 
+	queues, concurrency, err := parseQueuesSetting(viper.Get("worker.queues"))
+	if err != nil {
+		return nil, err
+	}
+	config.Worker.Queues = queues
+	config.Worker.QueueConcurrency = concurrency
+
 	// Backward compat: if worker.queues is empty, fall back to worker.queue (singular)
 	if len(config.Worker.Queues) == 0 {
 		if q := viper.GetString("worker.queue"); q != "" {
@@ -53,5 +92,105 @@ func LoadConfig() (*Config, error) {
 		}
 	}
 
+	if viper.IsSet("worker.shutdown_timeout") {
+		config.Worker.ShutdownTimeout = viper.GetDuration("worker.shutdown_timeout")
+	}
+
+	if labels := viper.GetStringMapString("worker.labels"); len(labels) > 0 {
+		config.Worker.Labels = labels
+	}
+
+	// Per-queue timeouts, e.g. worker.timeouts: {ci: 30m, notifications: 1m}
+	if raw := viper.GetStringMapString("worker.timeouts"); len(raw) > 0 {
+		config.Worker.Timeouts = make(map[string]time.Duration, len(raw))
+		for queueName, value := range raw {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid timeout for queue %q: %w", queueName, err)
+			}
+			config.Worker.Timeouts[queueName] = d
+		}
+	}
+
 	return config, nil
 }
+
+// ParseQueues parses queue specs of the form "name" or "name=concurrency",
+// as in --queue ci=2,notifications=20. It returns the queue names in order
+// and the concurrency of the queues that set one.
+func ParseQueues(specs []string) ([]string, map[string]int, error) {
+	var queues []string
+	var concurrency map[string]int
+	for _, spec := range specs {
+		name, value, hasValue := strings.Cut(strings.TrimSpace(spec), "=")
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, nil, fmt.Errorf("invalid queue %q: name is empty", spec)
+		}
+		queues = append(queues, name)
+		if !hasValue {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || n < 1 {
+			return nil, nil, fmt.Errorf("invalid concurrency for queue %q: must be a positive number", name)
+		}
+		if concurrency == nil {
+			concurrency = make(map[string]int)
+		}
+		concurrency[name] = n
+	}
+	return queues, concurrency, nil
+}
+
+// parseQueuesSetting reads worker.queues, which is a list whose entries are
+// either queue specs like "ci=2" or maps like {name: ci, concurrency: 2}.
+// A comma-separated string, e.g. from QQ_WORKER_QUEUES, is also accepted.
+func parseQueuesSetting(raw interface{}) ([]string, map[string]int, error) {
+	var specs []string
+	switch v := raw.(type) {
+	case nil:
+		return nil, nil, nil
+	case string:
+		if v == "" {
+			return nil, nil, nil
+		}
+		specs = strings.Split(v, ",")
+	case []string:
+		specs = v
+	case []interface{}:
+		for _, entry := range v {
+			switch e := entry.(type) {
+			case map[string]interface{}:
+				name := fmt.Sprint(e["name"])
+				if e["name"] == nil || name == "" {
+					return nil, nil, fmt.Errorf("invalid worker.queues entry %v: name is required", e)
+				}
+				if c, ok := e["concurrency"]; ok {
+					name += "=" + fmt.Sprint(c)
+				}
+				specs = append(specs, name)
+			default:
+				specs = append(specs, fmt.Sprint(e))
+			}
+		}
+	default:
+		return nil, nil, fmt.Errorf("invalid worker.queues: expected a list of queues")
+	}
+	return ParseQueues(specs)
+}
+
+// ParseLabels parses worker labels of the form "key=value", as in
+// --label os=linux. A bare "key" is a label with an empty value.
+func ParseLabels(specs []string) (map[string]string, error) {
+	labels := make(map[string]string, len(specs))
+	for _, spec := range specs {
+		key, value, _ := strings.Cut(spec, "=")
+		key = strings.TrimSpace(key)
+		if key == "" || strings.ContainsAny(key, "! \t") {
+			return nil, fmt.Errorf("invalid label %q: use key=value", spec)
+		}
+		labels[key] = strings.TrimSpace(value)
+	}
+	return labels, nil
+}
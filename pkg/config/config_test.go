@@ -0,0 +1,51 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseQueues(t *testing.T) {
+	queues, concurrency, err := ParseQueues([]string{"default", "ci=2", " notifications = 20 "})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"default", "ci", "notifications"}, queues)
+	assert.Equal(t, map[string]int{"ci": 2, "notifications": 20}, concurrency)
+
+	_, _, err = ParseQueues([]string{"ci=0"})
+	assert.EqualError(t, err, `invalid concurrency for queue "ci": must be a positive number`)
+
+	_, _, err = ParseQueues([]string{"=2"})
+	assert.EqualError(t, err, `invalid queue "=2": name is empty`)
+}
+
+func TestParseQueuesSetting(t *testing.T) {
+	// worker.queues as YAML decodes it: plain names, specs and maps
+	raw := []interface{}{
+		"default",
+		"ci=2",
+		map[string]interface{}{"name": "notifications", "concurrency": 20},
+		map[string]interface{}{"name": "reports"},
+	}
+	queues, concurrency, err := parseQueuesSetting(raw)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"default", "ci", "notifications", "reports"}, queues)
+	assert.Equal(t, map[string]int{"ci": 2, "notifications": 20}, concurrency)
+
+	queues, _, err = parseQueuesSetting("default,ci")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"default", "ci"}, queues)
+
+	_, _, err = parseQueuesSetting([]interface{}{map[string]interface{}{"concurrency": 2}})
+	assert.Error(t, err)
+}
+
+func TestParseLabels(t *testing.T) {
+	labels, err := ParseLabels([]string{"os=linux", "disk = ssd", "gpu"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"os": "linux", "disk": "ssd", "gpu": ""}, labels)
+
+	_, err = ParseLabels([]string{"=linux"})
+	assert.EqualError(t, err, `invalid label "=linux": use key=value`)
+}
@@ -4,15 +4,34 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/riverqueue/river"
 	"gopkg.in/yaml.v3"
 )
 
-// ApplyFile represents the top-level YAML structure for a pipeline file
+// ApplyFile represents the top-level YAML structure for a pipeline file.
+// Env, Workdir and Timezone are defaults for every job in the pipeline. Vars are
+// substituted for {{ .vars.x }} in job fields and the run key when the file
+// is rendered. While a run with the same RunKey is unfinished, applying the
+// file again returns that run's jobs instead of inserting new ones.
 type ApplyFile struct {
-	Jobs []ApplyJob `yaml:"jobs"`
+	Name    string            `yaml:"name,omitempty"`
+	RunKey  string            `yaml:"run_key,omitempty"`
+	Vars    map[string]string `yaml:"vars,omitempty"`
+	Env     map[string]string `yaml:"env,omitempty"`
+	Workdir string            `yaml:"workdir,omitempty"`
+	Jobs    []ApplyJob        `yaml:"jobs"`
+
+	// Timezone is the IANA time zone of job schedules without an offset
+	// (default: the local time zone)
+	Timezone string `yaml:"timezone,omitempty"`
+
+	source []byte // the YAML the file was parsed from
 }
 
 // ApplyJob represents a single job in a pipeline YAML file
@@ -20,8 +39,27 @@ type ApplyJob struct {
 	Name      string            `yaml:"name"`
 	Command   string            `yaml:"command"`
 	Queue     string            `yaml:"queue"`
-	Priority  int               `yaml:"priority"`
-	DependsOn []ApplyDependency `yaml:"depends_on"`
+	Priority  int               `yaml:"priority"` // zero uses the queue's default priority
+	Timeout   time.Duration     `yaml:"timeout,omitempty"`
+	Retry     *RetryPolicy      `yaml:"retry,omitempty"`
+	Env       map[string]string `yaml:"env,omitempty"`
+	Workdir   string            `yaml:"workdir,omitempty"`
+	DependsOn []ApplyDependency `yaml:"depends_on,omitempty"`
+	Requires  []string          `yaml:"requires,omitempty"` // requirements on worker labels, see MatchLabels
+
+	// Schedule or Delay defer the job: Schedule is a time in any format
+	// ParseScheduleTime accepts, read in Timezone, and Delay is relative to
+	// when the pipeline is applied. A job with dependencies runs once both
+	// its time has come and its dependencies allow.
+	Schedule string        `yaml:"schedule,omitempty"`
+	Delay    time.Duration `yaml:"delay,omitempty"`
+	Timezone string        `yaml:"timezone,omitempty"`
+
+	// Matrix expands the job into one job per combination of the axis
+	// values, see expandMatrix. Each job can use its values as
+	// {{ .matrix.axis }} in templates.
+	Matrix       map[string][]string `yaml:"matrix,omitempty"`
+	matrixValues map[string]string
 }
 
 // ApplyDependency represents a dependency reference in a pipeline YAML file
@@ -35,6 +73,11 @@ type ApplyResult struct {
 	Name  string
 	JobID int64
 	Queue string
+	RunID int64 // the pipeline run the job belongs to
+
+	// Existing is set when the job was not inserted because an unfinished
+	// run with the same run key already had it
+	Existing bool
 }
 
 // ParseApplyFile reads and parses a pipeline YAML file
@@ -43,7 +86,16 @@ func ParseApplyFile(filePath string) (*ApplyFile, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to read file: %w", err)
 	}
-	return ParseApplyFileBytes(data)
+	af, err := ParseApplyFileBytes(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pipelines without a name are named after their file
+	if af.Name == "" {
+		af.Name = strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath))
+	}
+	return af, nil
 }
 
 // ParseApplyFileBytes parses pipeline YAML from bytes
@@ -52,15 +104,21 @@ func ParseApplyFileBytes(data []byte) (*ApplyFile, error) {
 	if err := yaml.Unmarshal(data, &af); err != nil {
 		return nil, fmt.Errorf("failed to parse YAML: %w", err)
 	}
+	af.source = data
 
 	// Apply defaults
 	for i := range af.Jobs {
 		if af.Jobs[i].Queue == "" {
 			af.Jobs[i].Queue = "default"
 		}
-		if af.Jobs[i].Priority == 0 {
-			af.Jobs[i].Priority = 1
+		if af.Jobs[i].Workdir == "" {
+			af.Jobs[i].Workdir = af.Workdir
+		}
+		if af.Jobs[i].Timezone == "" {
+			af.Jobs[i].Timezone = af.Timezone
 		}
+		// Job variables override pipeline-level ones
+		af.Jobs[i].Env = mergeEnv(af.Env, af.Jobs[i].Env)
 		for j := range af.Jobs[i].DependsOn {
 			if af.Jobs[i].DependsOn[j].Condition == "" {
 				af.Jobs[i].DependsOn[j].Condition = "succeeded"
@@ -68,6 +126,14 @@ func ParseApplyFileBytes(data []byte) (*ApplyFile, error) {
 		}
 	}
 
+	// Expand matrix jobs now, so that validation and cycle detection see
+	// the jobs that will actually be inserted
+	jobs, err := expandMatrix(af.Jobs)
+	if err != nil {
+		return nil, err
+	}
+	af.Jobs = jobs
+
 	return &af, nil
 }
 
@@ -88,6 +154,26 @@ func (af *ApplyFile) Validate() error {
 		if names[job.Name] {
 			return fmt.Errorf("duplicate job name: %q", job.Name)
 		}
+		if job.Timeout < 0 {
+			return fmt.Errorf("job %q has negative timeout %s", job.Name, job.Timeout)
+		}
+		if job.Delay < 0 {
+			return fmt.Errorf("job %q has negative delay %s", job.Name, job.Delay)
+		}
+		if job.Delay > 0 && job.Schedule != "" {
+			return fmt.Errorf("job %q can't have both a schedule and a delay", job.Name)
+		}
+		if _, err := LoadScheduleLocation(job.Timezone); err != nil {
+			return fmt.Errorf("job %q: %w", job.Name, err)
+		}
+		if err := validateEnvKeys(job.Env); err != nil {
+			return fmt.Errorf("job %q: %w", job.Name, err)
+		}
+		if job.Retry != nil {
+			if err := job.Retry.Validate(); err != nil {
+				return fmt.Errorf("job %q has invalid retry policy: %w", job.Name, err)
+			}
+		}
 		names[job.Name] = true
 	}
 
@@ -106,6 +192,11 @@ func (af *ApplyFile) Validate() error {
 		}
 	}
 
+	// Every variable the templates use must be set
+	if err := af.renderJobs(false); err != nil {
+		return err
+	}
+
 	// Cycle detection via Kahn's algorithm
 	if err := detectCycles(af.Jobs); err != nil {
 		return err
@@ -116,6 +207,14 @@ func (af *ApplyFile) Validate() error {
 
 // detectCycles uses Kahn's algorithm to detect cycles in the dependency graph
 func detectCycles(jobs []ApplyJob) error {
+	_, err := topologicalLevels(jobs)
+	return err
+}
+
+// topologicalLevels orders the jobs with Kahn's algorithm, one level at a
+// time: a level holds the indexes of the jobs whose dependencies are all in
+// earlier levels, in file order. It fails if the dependencies have a cycle.
+func topologicalLevels(jobs []ApplyJob) ([][]int, error) {
 	// Build adjacency list and in-degree map
 	nameToIdx := make(map[string]int)
 	for i, job := range jobs {
@@ -146,24 +245,29 @@ func detectCycles(jobs []ApplyJob) error {
 		}
 	}
 
+	var levels [][]int
 	visited := 0
 	for len(queue) > 0 {
-		node := queue[0]
-		queue = queue[1:]
-		visited++
-
-		for _, dependent := range dependents[node] {
-			inDegree[dependent]--
-			if inDegree[dependent] == 0 {
-				queue = append(queue, dependent)
+		levels = append(levels, queue)
+		visited += len(queue)
+
+		var next []int
+		for _, node := range queue {
+			for _, dependent := range dependents[node] {
+				inDegree[dependent]--
+				if inDegree[dependent] == 0 {
+					next = append(next, dependent)
+				}
 			}
 		}
+		sort.Ints(next)
+		queue = next
 	}
 
 	if visited != len(jobs) {
-		return fmt.Errorf("dependency cycle detected")
+		return nil, fmt.Errorf("dependency cycle detected")
 	}
-	return nil
+	return levels, nil
 }
 
 // ApplyFile inserts all jobs from a pipeline YAML file atomically
@@ -184,24 +288,29 @@ func (q *QueueClient) ApplyFileBytes(ctx context.Context, data []byte) ([]ApplyR
 	return q.applyParsed(ctx, af)
 }
 
+// Apply inserts all jobs of a parsed pipeline file atomically, after
+// expanding its variables. Use it to apply a file with variables set by
+// SetVars.
+func (q *QueueClient) Apply(ctx context.Context, af *ApplyFile) ([]ApplyResult, error) {
+	return q.applyParsed(ctx, af)
+}
+
+// ValidationError is returned by Apply and AddJobWithOptions for pipelines
+// and jobs that are invalid, as opposed to ones that could not be inserted
+type ValidationError struct {
+	Err error
+}
+
+func (e *ValidationError) Error() string { return e.Err.Error() }
+
+func (e *ValidationError) Unwrap() error { return e.Err }
+
 func (q *QueueClient) applyParsed(ctx context.Context, af *ApplyFile) ([]ApplyResult, error) {
 	if err := af.Validate(); err != nil {
-		return nil, fmt.Errorf("validation error: %w", err)
+		return nil, &ValidationError{Err: fmt.Errorf("validation error: %w", err)}
 	}
-
-	// Build insert params for all jobs
-	insertParams := make([]river.InsertManyParams, len(af.Jobs))
-	for i, job := range af.Jobs {
-		opts := river.InsertOpts{
-			Priority: job.Priority,
-		}
-		if job.Queue != "default" {
-			opts.Queue = job.Queue
-		}
-		insertParams[i] = river.InsertManyParams{
-			Args:       BashJobArgs{Command: job.Command},
-			InsertOpts: &opts,
-		}
+	if err := af.Render(); err != nil {
+		return nil, &ValidationError{Err: fmt.Errorf("validation error: %w", err)}
 	}
 
 	// Begin transaction
@@ -211,16 +320,126 @@ func (q *QueueClient) applyParsed(ctx context.Context, af *ApplyFile) ([]ApplyRe
 	}
 	defer tx.Rollback(ctx)
 
+	results, err := q.applyTx(ctx, tx, af)
+	if err != nil {
+		return nil, err
+	}
+
+	// Commit
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return results, nil
+}
+
+// applyTx submits a validated and rendered pipeline within tx and records
+// it as a pipeline run
+func (q *QueueClient) applyTx(ctx context.Context, tx pgx.Tx, af *ApplyFile) ([]ApplyResult, error) {
+	// Return the jobs of an unfinished run with the same key instead of
+	// submitting the pipeline again
+	if af.RunKey != "" {
+		runID, err := q.activePipelineRunTx(ctx, tx, af.RunKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up run key: %w", err)
+		}
+		if runID != 0 {
+			return q.existingPipelineRunResults(ctx, runID)
+		}
+	}
+
 	// Insert all jobs atomically
+	results, err := q.insertPipelineJobsTx(ctx, tx, af, make(map[string]int64))
+	if err != nil {
+		return nil, err
+	}
+
+	// Record the pipeline run
+	runID, err := addPipelineRunTx(ctx, tx, af, results)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record pipeline run: %w", err)
+	}
+	for i := range results {
+		results[i].RunID = runID
+	}
+	return results, nil
+}
+
+// insertPipelineJobsTx inserts the jobs of a pipeline file and their
+// dependencies. Jobs already in nameToID are not inserted; jobs that depend
+// on them depend on the existing job instead. nameToID is updated with the
+// inserted jobs.
+func (q *QueueClient) insertPipelineJobsTx(ctx context.Context, tx pgx.Tx, af *ApplyFile, nameToID map[string]int64) ([]ApplyResult, error) {
+	// Jobs without a priority get their queue's default priority
+	queueNames := make([]string, 0, len(af.Jobs))
+	for _, job := range af.Jobs {
+		if job.Priority == 0 {
+			queueNames = append(queueNames, job.Queue)
+		}
+	}
+	var queueConfigs map[string]QueueConfig
+	if len(queueNames) > 0 {
+		var err error
+		if queueConfigs, err = loadQueueConfigs(ctx, q.pool, queueNames); err != nil {
+			return nil, err
+		}
+	}
+
+	// Build insert params for the jobs that don't exist yet
+	var toInsert []ApplyJob
+	var insertParams []river.InsertManyParams
+	now := time.Now()
+	for _, job := range af.Jobs {
+		if _, exists := nameToID[job.Name]; exists {
+			continue
+		}
+		scheduledAt, err := job.scheduledAt(now)
+		if err != nil {
+			return nil, fmt.Errorf("job %q: %w", job.Name, err)
+		}
+		opts := river.InsertOpts{
+			Priority:    resolvePriority(job.Priority, job.Queue, queueConfigs),
+			ScheduledAt: scheduledAt,
+		}
+		if opts.Queue, err = routeQueueTx(ctx, q.pool, tx, job.Queue, job.Requires); err != nil {
+			return nil, fmt.Errorf("job %q: %w", job.Name, err)
+		}
+		if job.Retry != nil {
+			opts.MaxAttempts = job.Retry.MaxAttempts
+		}
+		// Jobs with dependencies wait in River's pending state until the
+		// release trigger created by qq init makes them available. Existing
+		// jobs have already finished, so they don't hold anything back.
+		for _, dep := range job.DependsOn {
+			if _, exists := nameToID[dep.Name]; !exists {
+				opts.Pending = true
+			}
+		}
+		toInsert = append(toInsert, job)
+		insertParams = append(insertParams, river.InsertManyParams{
+			Args: BashJobArgs{
+				Command:        job.Command,
+				Env:            job.Env,
+				Workdir:        job.Workdir,
+				TimeoutSeconds: timeoutSeconds(job.Timeout),
+				Retry:          job.Retry,
+				Requires:       job.Requires,
+			},
+			InsertOpts: &opts,
+		})
+	}
+	if len(insertParams) == 0 {
+		return nil, nil
+	}
+
 	insertResults, err := q.client.InsertManyTx(ctx, tx, insertParams)
 	if err != nil {
 		return nil, fmt.Errorf("failed to insert jobs: %w", err)
 	}
 
 	// Build name → job ID map
-	nameToID := make(map[string]int64)
-	results := make([]ApplyResult, len(af.Jobs))
-	for i, job := range af.Jobs {
+	results := make([]ApplyResult, len(toInsert))
+	for i, job := range toInsert {
 		jobID := insertResults[i].Job.ID
 		nameToID[job.Name] = jobID
 		results[i] = ApplyResult{
@@ -230,10 +449,14 @@ func (q *QueueClient) applyParsed(ctx context.Context, af *ApplyFile) ([]ApplyRe
 		}
 	}
 
-	// Insert dependency rows
+	// Insert dependency rows. ID 0 stands for a job that finished and is
+	// gone, which needs no row.
 	var deps []JobDependency
-	for _, job := range af.Jobs {
+	for _, job := range toInsert {
 		for _, dep := range job.DependsOn {
+			if nameToID[dep.Name] == 0 {
+				continue
+			}
 			deps = append(deps, JobDependency{
 				JobID:       nameToID[job.Name],
 				DependsOnID: nameToID[dep.Name],
@@ -248,11 +471,6 @@ func (q *QueueClient) applyParsed(ctx context.Context, af *ApplyFile) ([]ApplyRe
 		}
 	}
 
-	// Commit
-	if err := tx.Commit(ctx); err != nil {
-		return nil, fmt.Errorf("failed to commit transaction: %w", err)
-	}
-
 	return results, nil
 }
 
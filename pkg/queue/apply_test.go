@@ -2,6 +2,7 @@ package queue
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -32,7 +33,7 @@ jobs:
 
 	assert.Equal(t, "test", af.Jobs[1].Name)
 	assert.Equal(t, "default", af.Jobs[1].Queue) // default applied
-	assert.Equal(t, 1, af.Jobs[1].Priority)       // default applied
+	assert.Equal(t, 0, af.Jobs[1].Priority)       // the queue's default, resolved on insert
 	assert.Len(t, af.Jobs[1].DependsOn, 1)
 	assert.Equal(t, "build", af.Jobs[1].DependsOn[0].Name)
 	assert.Equal(t, "succeeded", af.Jobs[1].DependsOn[0].Condition)
@@ -52,7 +53,7 @@ jobs:
 	require.NoError(t, err)
 
 	assert.Equal(t, "default", af.Jobs[0].Queue)
-	assert.Equal(t, 1, af.Jobs[0].Priority)
+	assert.Equal(t, 0, af.Jobs[0].Priority)
 	assert.Equal(t, "succeeded", af.Jobs[1].DependsOn[0].Condition)
 }
 
@@ -162,3 +163,59 @@ func TestParseApplyFileBytes_InvalidYAML(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to parse YAML")
 }
+
+func TestParseApplyFileBytes_Timeout(t *testing.T) {
+	af, err := ParseApplyFileBytes([]byte(`
+jobs:
+  - name: sync
+    command: "./sync.sh"
+    timeout: 15m
+  - name: quick
+    command: "echo hi"
+`))
+	require.NoError(t, err)
+	assert.Equal(t, 15*time.Minute, af.Jobs[0].Timeout)
+	assert.Equal(t, time.Duration(0), af.Jobs[1].Timeout)
+}
+
+func TestValidate_NegativeTimeout(t *testing.T) {
+	af := &ApplyFile{Jobs: []ApplyJob{{Name: "a", Command: "echo a", Timeout: -time.Second}}}
+	err := af.Validate()
+	assert.EqualError(t, err, `job "a" has negative timeout -1s`)
+}
+
+func TestTimeoutSeconds(t *testing.T) {
+	assert.Equal(t, 0, timeoutSeconds(0))
+	assert.Equal(t, 1, timeoutSeconds(500*time.Millisecond))
+	assert.Equal(t, 90, timeoutSeconds(90*time.Second))
+}
+
+func TestParseApplyFileBytes_EnvAndWorkdir(t *testing.T) {
+	af, err := ParseApplyFileBytes([]byte(`
+env:
+  STAGE: prod
+  LOG_LEVEL: info
+workdir: /srv/pipeline
+jobs:
+  - name: build
+    command: "make"
+    env:
+      LOG_LEVEL: debug
+  - name: deploy
+    command: "./deploy.sh"
+    workdir: /srv/deploy
+`))
+	require.NoError(t, err)
+
+	// Job values override the pipeline defaults
+	assert.Equal(t, map[string]string{"STAGE": "prod", "LOG_LEVEL": "debug"}, af.Jobs[0].Env)
+	assert.Equal(t, "/srv/pipeline", af.Jobs[0].Workdir)
+	assert.Equal(t, map[string]string{"STAGE": "prod", "LOG_LEVEL": "info"}, af.Jobs[1].Env)
+	assert.Equal(t, "/srv/deploy", af.Jobs[1].Workdir)
+}
+
+func TestValidate_InvalidEnvName(t *testing.T) {
+	af := &ApplyFile{Jobs: []ApplyJob{{Name: "a", Command: "echo a", Env: map[string]string{"A=B": "c"}}}}
+	err := af.Validate()
+	assert.EqualError(t, err, `job "a": invalid environment variable name "A=B"`)
+}
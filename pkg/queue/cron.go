@@ -0,0 +1,299 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/riverqueue/river"
+	"github.com/robfig/cron/v3"
+)
+
+// cronPollInterval is how often workers look for due cron schedules
+const cronPollInterval = 10 * time.Second
+
+// CronSchedule is a command or pipeline that workers enqueue on a cron
+// schedule. Exactly one of Command and Pipeline is set.
+type CronSchedule struct {
+	ID        int64
+	Name      string
+	Spec      string            // standard 5-field cron spec or descriptor like @hourly
+	Command   string            // command to enqueue as a job
+	Pipeline  string            // pipeline YAML to apply
+	Vars      map[string]string // variables the pipeline is rendered with
+	Queue     string            // queue of command jobs
+	Priority  int               // priority of command jobs, zero for the queue's default
+	Paused    bool
+	NextRunAt time.Time
+	LastRunAt *time.Time
+	LastError string // why the last tick failed to enqueue, if it did
+	CreatedAt time.Time
+}
+
+// parseCronSpec parses a standard cron spec. Specs are evaluated in UTC
+// unless they start with CRON_TZ=<zone>.
+func parseCronSpec(spec string) (cron.Schedule, error) {
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron spec %q: %w", spec, err)
+	}
+	return schedule, nil
+}
+
+// validate checks the spec and target of a schedule, and returns the parsed
+// spec
+func (s *CronSchedule) validate() (cron.Schedule, error) {
+	schedule, err := parseCronSpec(s.Spec)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case s.Command == "" && s.Pipeline == "":
+		return nil, fmt.Errorf("cron schedule needs a command or a pipeline")
+	case s.Command != "" && s.Pipeline != "":
+		return nil, fmt.Errorf("cron schedule can't have both a command and a pipeline")
+	case s.Pipeline != "":
+		if _, err := s.pipelineFile(); err != nil {
+			return nil, err
+		}
+	}
+	return schedule, nil
+}
+
+// pipelineFile parses, validates and renders the pipeline of a schedule
+func (s *CronSchedule) pipelineFile() (*ApplyFile, error) {
+	af, err := ParseApplyFileBytes([]byte(s.Pipeline))
+	if err != nil {
+		return nil, err
+	}
+	if s.Name != "" {
+		af.Name = s.Name
+	}
+	af.SetVars(s.Vars)
+	if err := af.Validate(); err != nil {
+		return nil, fmt.Errorf("validation error: %w", err)
+	}
+	if err := af.Render(); err != nil {
+		return nil, fmt.Errorf("validation error: %w", err)
+	}
+	return af, nil
+}
+
+// AddCronSchedule validates and stores a cron schedule, filling in its ID
+// and first run time
+func (q *QueueClient) AddCronSchedule(ctx context.Context, s *CronSchedule) error {
+	schedule, err := s.validate()
+	if err != nil {
+		return err
+	}
+	if s.Queue == "" {
+		s.Queue = "default"
+	}
+	s.NextRunAt = schedule.Next(time.Now().UTC())
+
+	err = q.pool.QueryRow(ctx, `
+		INSERT INTO cron_schedules (name, spec, command, pipeline, vars, queue, priority, next_run_at)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), $5, $6, $7, $8)
+		RETURNING id, created_at
+	`, s.Name, s.Spec, s.Command, s.Pipeline, s.Vars, s.Queue, s.Priority, s.NextRunAt).Scan(&s.ID, &s.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to add cron schedule: %w", err)
+	}
+	return nil
+}
+
+// ListCronSchedules retrieves all cron schedules
+func (q *QueueClient) ListCronSchedules(ctx context.Context) ([]CronSchedule, error) {
+	rows, err := q.pool.Query(ctx, `
+		SELECT id, name, spec, COALESCE(command, ''), COALESCE(pipeline, ''), COALESCE(vars, '{}'),
+			queue, priority, paused, next_run_at, last_run_at, COALESCE(last_error, ''), created_at
+		FROM cron_schedules
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query cron schedules: %w", err)
+	}
+	defer rows.Close()
+
+	var schedules []CronSchedule
+	for rows.Next() {
+		var s CronSchedule
+		err := rows.Scan(&s.ID, &s.Name, &s.Spec, &s.Command, &s.Pipeline, &s.Vars,
+			&s.Queue, &s.Priority, &s.Paused, &s.NextRunAt, &s.LastRunAt, &s.LastError, &s.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan cron schedule: %w", err)
+		}
+		schedules = append(schedules, s)
+	}
+	return schedules, rows.Err()
+}
+
+// RemoveCronSchedule deletes a cron schedule. Jobs it already enqueued are
+// not affected.
+func (q *QueueClient) RemoveCronSchedule(ctx context.Context, id int64) error {
+	tag, err := q.pool.Exec(ctx, `DELETE FROM cron_schedules WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to remove cron schedule: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("cron schedule %d not found", id)
+	}
+	return nil
+}
+
+// SetCronSchedulePaused pauses or resumes a cron schedule. A resumed
+// schedule continues from its next tick; ticks missed while it was paused
+// are skipped.
+func (q *QueueClient) SetCronSchedulePaused(ctx context.Context, id int64, paused bool) error {
+	var spec string
+	err := q.pool.QueryRow(ctx, `SELECT spec FROM cron_schedules WHERE id = $1`, id).Scan(&spec)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("cron schedule %d not found", id)
+		}
+		return fmt.Errorf("failed to get cron schedule: %w", err)
+	}
+
+	if paused {
+		_, err = q.pool.Exec(ctx, `UPDATE cron_schedules SET paused = TRUE WHERE id = $1`, id)
+	} else {
+		schedule, parseErr := parseCronSpec(spec)
+		if parseErr != nil {
+			return parseErr
+		}
+		_, err = q.pool.Exec(ctx, `
+			UPDATE cron_schedules SET paused = FALSE, next_run_at = $2 WHERE id = $1 AND paused
+		`, id, schedule.Next(time.Now().UTC()))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update cron schedule: %w", err)
+	}
+	return nil
+}
+
+// runCronScheduler fires due cron schedules until ctx is cancelled. Every
+// worker runs it: rather than relying on an elected leader, which like
+// River's periodic jobs only keeps its schedule in memory, workers claim due
+// schedules with FOR UPDATE SKIP LOCKED and move next_run_at forward in the
+// transaction that enqueues the jobs. Each tick therefore fires exactly once
+// across any number of workers, and a tick missed while no worker was
+// running fires once when one starts.
+func (q *QueueClient) runCronScheduler(ctx context.Context) {
+	ticker := time.NewTicker(cronPollInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			fired, err := q.fireNextCronSchedule(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					fmt.Println("Failed to fire cron schedules:", err)
+				}
+				break
+			}
+			if !fired {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// fireNextCronSchedule enqueues the jobs of one due cron schedule, if there
+// is one that no other worker is firing. A schedule that fails to enqueue,
+// e.g. because its pipeline no longer validates, records the error and
+// still moves on to its next tick.
+func (q *QueueClient) fireNextCronSchedule(ctx context.Context) (bool, error) {
+	tx, err := q.pool.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	var s CronSchedule
+	var now time.Time
+	err = tx.QueryRow(ctx, `
+		SELECT id, name, spec, COALESCE(command, ''), COALESCE(pipeline, ''), COALESCE(vars, '{}'),
+			queue, priority, NOW()
+		FROM cron_schedules
+		WHERE NOT paused AND next_run_at <= NOW()
+		ORDER BY next_run_at
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	`).Scan(&s.ID, &s.Name, &s.Spec, &s.Command, &s.Pipeline, &s.Vars, &s.Queue, &s.Priority, &now)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// Enqueue in a savepoint, so that a failure is recorded rather than
+	// aborting the transaction
+	var lastError string
+	if fireErr := q.fireCronScheduleTx(ctx, tx, &s); fireErr != nil {
+		lastError = fireErr.Error()
+		fmt.Printf("Cron schedule %d failed to enqueue: %v\n", s.ID, fireErr)
+	}
+
+	// The next tick is computed even if the spec fails to parse, so that a
+	// broken schedule doesn't block the others
+	nextRunAt := now.Add(24 * time.Hour)
+	if schedule, err := parseCronSpec(s.Spec); err == nil {
+		nextRunAt = schedule.Next(now.UTC())
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE cron_schedules
+		SET next_run_at = $2, last_run_at = $3, last_error = NULLIF($4, '')
+		WHERE id = $1
+	`, s.ID, nextRunAt, now, lastError)
+	if err != nil {
+		return false, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// fireCronScheduleTx enqueues a tick of a cron schedule within a savepoint
+// of tx
+func (q *QueueClient) fireCronScheduleTx(ctx context.Context, tx pgx.Tx, s *CronSchedule) error {
+	sp, err := tx.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer sp.Rollback(ctx)
+
+	if s.Pipeline != "" {
+		af, err := s.pipelineFile()
+		if err != nil {
+			return err
+		}
+		if _, err := q.applyTx(ctx, sp, af); err != nil {
+			return err
+		}
+	} else {
+		queueConfigs, err := loadQueueConfigs(ctx, q.pool, []string{s.Queue})
+		if err != nil {
+			return err
+		}
+		opts := &river.InsertOpts{Priority: resolvePriority(s.Priority, s.Queue, queueConfigs)}
+		if s.Queue != "default" {
+			opts.Queue = s.Queue
+		}
+		if _, err := q.client.InsertTx(ctx, sp, BashJobArgs{Command: s.Command}, opts); err != nil {
+			return fmt.Errorf("failed to insert job: %w", err)
+		}
+	}
+	return sp.Commit(ctx)
+}
@@ -0,0 +1,63 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCronSpec(t *testing.T) {
+	from := time.Date(2025, 3, 1, 10, 7, 0, 0, time.UTC)
+
+	schedule, err := parseCronSpec("*/15 * * * *")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2025, 3, 1, 10, 15, 0, 0, time.UTC), schedule.Next(from))
+
+	schedule, err = parseCronSpec("@daily")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC), schedule.Next(from))
+
+	// CRON_TZ evaluates the spec in another zone
+	schedule, err = parseCronSpec("CRON_TZ=America/New_York 0 9 * * *")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2025, 3, 1, 14, 0, 0, 0, time.UTC), schedule.Next(from).UTC())
+
+	_, err = parseCronSpec("every monday")
+	assert.Error(t, err)
+}
+
+func TestCronSchedule_Validate(t *testing.T) {
+	_, err := (&CronSchedule{Spec: "@hourly"}).validate()
+	assert.EqualError(t, err, "cron schedule needs a command or a pipeline")
+
+	_, err = (&CronSchedule{Spec: "@hourly", Command: "echo", Pipeline: "jobs: []"}).validate()
+	assert.EqualError(t, err, "cron schedule can't have both a command and a pipeline")
+
+	_, err = (&CronSchedule{Spec: "@hourly", Pipeline: "jobs: []"}).validate()
+	assert.EqualError(t, err, "validation error: no jobs defined")
+
+	_, err = (&CronSchedule{Spec: "@hourly", Command: "echo"}).validate()
+	assert.NoError(t, err)
+}
+
+func TestCronSchedule_PipelineFile(t *testing.T) {
+	s := &CronSchedule{
+		Name: "nightly",
+		Spec: "@daily",
+		Pipeline: `
+vars:
+  env: staging
+jobs:
+  - name: export
+    command: "export --env={{ .vars.env }}"
+`,
+		Vars: map[string]string{"env": "prod"},
+	}
+
+	af, err := s.pipelineFile()
+	require.NoError(t, err)
+	assert.Equal(t, "nightly", af.Name)
+	assert.Equal(t, "export --env=prod", af.Jobs[0].Command)
+}
@@ -0,0 +1,80 @@
+package queue
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ParseEnvAssignments parses KEY=VALUE strings, as given to
+// "qq job add --env", into a map
+func ParseEnvAssignments(assignments []string) (map[string]string, error) {
+	if len(assignments) == 0 {
+		return nil, nil
+	}
+	env := make(map[string]string, len(assignments))
+	for _, a := range assignments {
+		key, value, ok := strings.Cut(a, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid environment variable %q (expected KEY=VALUE)", a)
+		}
+		env[key] = value
+	}
+	return env, nil
+}
+
+// validateEnvKeys checks that every key can be used as an environment
+// variable name
+func validateEnvKeys(env map[string]string) error {
+	for key := range env {
+		if key == "" || strings.ContainsAny(key, "=\x00") {
+			return fmt.Errorf("invalid environment variable name %q", key)
+		}
+	}
+	return nil
+}
+
+// mergeEnv returns base overlaid with overrides, without modifying either
+func mergeEnv(base, overrides map[string]string) map[string]string {
+	if len(base) == 0 && len(overrides) == 0 {
+		return nil
+	}
+	merged := make(map[string]string, len(base)+len(overrides))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range overrides {
+		merged[k] = v
+	}
+	return merged
+}
+
+// buildJobEnv returns the environment for a job's command: the worker's own
+// environment, reduced to allowlist when one is set, with the job's
+// variables on top.
+func buildJobEnv(allowlist []string, jobEnv map[string]string) []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		key, _, _ := strings.Cut(kv, "=")
+		if len(allowlist) > 0 && !slices.Contains(allowlist, key) {
+			continue
+		}
+		if _, overridden := jobEnv[key]; overridden {
+			continue
+		}
+		env = append(env, kv)
+	}
+
+	// Sorted so the command sees a stable environment
+	keys := make([]string, 0, len(jobEnv))
+	for key := range jobEnv {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		env = append(env, key+"="+jobEnv[key])
+	}
+	return env
+}
@@ -0,0 +1,35 @@
+package queue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEnvAssignments(t *testing.T) {
+	env, err := ParseEnvAssignments([]string{"CI=true", "EMPTY=", "URL=http://x/?a=b"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"CI": "true", "EMPTY": "", "URL": "http://x/?a=b"}, env)
+
+	_, err = ParseEnvAssignments([]string{"NOVALUE"})
+	assert.Error(t, err)
+	_, err = ParseEnvAssignments([]string{"=value"})
+	assert.Error(t, err)
+}
+
+func TestBuildJobEnv(t *testing.T) {
+	t.Setenv("QQ_TEST_KEEP", "keep")
+	t.Setenv("QQ_TEST_DROP", "drop")
+	t.Setenv("QQ_TEST_OVERRIDE", "worker")
+
+	env := buildJobEnv(nil, map[string]string{"QQ_TEST_OVERRIDE": "job"})
+	assert.Contains(t, env, "QQ_TEST_KEEP=keep")
+	assert.Contains(t, env, "QQ_TEST_DROP=drop")
+	assert.Contains(t, env, "QQ_TEST_OVERRIDE=job")
+	assert.NotContains(t, env, "QQ_TEST_OVERRIDE=worker")
+
+	// With an allowlist only the listed worker variables are inherited
+	env = buildJobEnv([]string{"QQ_TEST_KEEP"}, map[string]string{"JOB_VAR": "1"})
+	assert.Equal(t, []string{"QQ_TEST_KEEP=keep", "JOB_VAR=1"}, env)
+}
@@ -0,0 +1,126 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// selector is a parsed job requirement on worker labels
+type selector struct {
+	key    string
+	value  string
+	negate bool // != for a value, else the label must not be set
+	exists bool // only whether the label is set matters
+}
+
+// parseSelector parses a job requirement: "key=value", "key!=value", "key"
+// (the worker has the label) or "!key" (it doesn't)
+func parseSelector(s string) (selector, error) {
+	s = strings.TrimSpace(s)
+	var sel selector
+	switch {
+	case strings.Contains(s, "!="):
+		sel.key, sel.value, _ = strings.Cut(s, "!=")
+		sel.negate = true
+	case strings.Contains(s, "="):
+		sel.key, sel.value, _ = strings.Cut(s, "=")
+	case strings.HasPrefix(s, "!"):
+		sel.key = strings.TrimPrefix(s, "!")
+		sel.negate, sel.exists = true, true
+	default:
+		sel.key = s
+		sel.exists = true
+	}
+	sel.key, sel.value = strings.TrimSpace(sel.key), strings.TrimSpace(sel.value)
+	if sel.key == "" || strings.ContainsAny(sel.key, "=! \t") {
+		return selector{}, fmt.Errorf("invalid requirement %q (use key=value, key!=value, key or !key)", s)
+	}
+	return sel, nil
+}
+
+func (sel selector) matches(labels map[string]string) bool {
+	value, ok := labels[sel.key]
+	if sel.exists {
+		return ok != sel.negate
+	}
+	if sel.negate {
+		return !ok || value != sel.value
+	}
+	return ok && value == sel.value
+}
+
+// ValidateRequirements checks the syntax of a job's requirements on worker
+// labels
+func ValidateRequirements(requires []string) error {
+	for _, s := range requires {
+		if _, err := parseSelector(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MatchLabels reports whether worker labels satisfy every requirement of a
+// job. Invalid requirements are never satisfied.
+func MatchLabels(requires []string, labels map[string]string) bool {
+	for _, s := range requires {
+		sel, err := parseSelector(s)
+		if err != nil || !sel.matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// waitingStates are the River states of jobs that have yet to run
+var waitingStates = map[string]bool{
+	"available": true,
+	"scheduled": true,
+	"retryable": true,
+	"pending":   true,
+}
+
+// markUnroutable sets Unroutable on the waiting jobs with requirements that
+// no live worker processing their queue satisfies
+func (q *QueueClient) markUnroutable(ctx context.Context, jobs []JobInfo) error {
+	needsCheck := false
+	for _, job := range jobs {
+		if len(job.Requires) > 0 && waitingStates[job.State] {
+			needsCheck = true
+			break
+		}
+	}
+	if !needsCheck {
+		return nil
+	}
+
+	workers, err := q.ListWorkers(ctx)
+	if err != nil {
+		return err
+	}
+	for i := range jobs {
+		job := &jobs[i]
+		if len(job.Requires) == 0 || !waitingStates[job.State] {
+			continue
+		}
+		job.Unroutable = !anyWorkerCanRun(workers, job.Queue, job.Requires)
+	}
+	return nil
+}
+
+// anyWorkerCanRun reports whether a live worker that isn't draining
+// processes the queue and has labels that satisfy the requirements
+func anyWorkerCanRun(workers []WorkerInfo, queueName string, requires []string) bool {
+	for _, w := range workers {
+		if w.Lost || w.Draining || !MatchLabels(requires, w.Labels) {
+			continue
+		}
+		for _, qi := range w.Queues {
+			if qi.Name == queueName {
+				return true
+			}
+		}
+	}
+	return false
+}
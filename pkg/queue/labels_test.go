@@ -0,0 +1,69 @@
+package queue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchLabels(t *testing.T) {
+	labels := map[string]string{"os": "linux", "disk": "ssd", "gpu": "a100"}
+
+	assert.True(t, MatchLabels(nil, labels))
+	assert.True(t, MatchLabels(nil, nil))
+	assert.True(t, MatchLabels([]string{"os=linux", "gpu"}, labels))
+	assert.True(t, MatchLabels([]string{"disk!=hdd", "!arm"}, labels))
+	assert.True(t, MatchLabels([]string{"arch!=arm64"}, labels))
+
+	assert.False(t, MatchLabels([]string{"os=darwin"}, labels))
+	assert.False(t, MatchLabels([]string{"os=linux", "fpga"}, labels))
+	assert.False(t, MatchLabels([]string{"!gpu"}, labels))
+	assert.False(t, MatchLabels([]string{"gpu"}, nil))
+}
+
+func TestValidateRequirements(t *testing.T) {
+	require.NoError(t, ValidateRequirements([]string{"os=linux", "disk!=hdd", "gpu", "!arm"}))
+
+	assert.EqualError(t, ValidateRequirements([]string{"=linux"}),
+		`invalid requirement "=linux" (use key=value, key!=value, key or !key)`)
+	assert.Error(t, ValidateRequirements([]string{"!"}))
+	assert.Error(t, ValidateRequirements([]string{"has space"}))
+}
+
+func TestAnyWorkerCanRun(t *testing.T) {
+	workers := []WorkerInfo{
+		{ID: "cpu", Labels: map[string]string{"os": "linux"}, Queues: []WorkerQueueInfo{{Name: "builds"}}},
+		{ID: "gpu-lost", Labels: map[string]string{"gpu": "a100"}, Queues: []WorkerQueueInfo{{Name: "builds"}}, Lost: true},
+		{ID: "gpu-other-queue", Labels: map[string]string{"gpu": "a100"}, Queues: []WorkerQueueInfo{{Name: "default"}}},
+	}
+
+	assert.True(t, anyWorkerCanRun(workers, "builds", []string{"os=linux"}))
+
+	// Only a lost worker, or one on another queue, has a GPU
+	assert.False(t, anyWorkerCanRun(workers, "builds", []string{"gpu"}))
+}
+
+func TestRender_Requires(t *testing.T) {
+	af, err := ParseApplyFileBytes([]byte(`
+vars:
+  gpu: a100
+jobs:
+  - name: train
+    command: "./train.sh"
+    requires: ["os=linux", "gpu={{ .vars.gpu }}"]
+`))
+	require.NoError(t, err)
+	require.NoError(t, af.Validate())
+	require.NoError(t, af.Render())
+	assert.Equal(t, []string{"os=linux", "gpu=a100"}, af.Jobs[0].Requires)
+
+	af, err = ParseApplyFileBytes([]byte(`
+jobs:
+  - name: train
+    command: "./train.sh"
+    requires: ["=linux"]
+`))
+	require.NoError(t, err)
+	assert.EqualError(t, af.Render(), `job "train": invalid requirement "=linux" (use key=value, key!=value, key or !key)`)
+}
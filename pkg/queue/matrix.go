@@ -0,0 +1,88 @@
+package queue
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// expandMatrix replaces every job with a matrix by one job per combination
+// of its axis values, named like "worker[chunk=3]" or
+// "build[arch=arm64,os=linux]" (axes sorted by name). A dependency on the
+// name of an expanded job becomes a dependency on every job it expanded to.
+func expandMatrix(jobs []ApplyJob) ([]ApplyJob, error) {
+	groups := make(map[string][]string)
+	var expanded []ApplyJob
+	for _, job := range jobs {
+		if len(job.Matrix) == 0 {
+			expanded = append(expanded, job)
+			continue
+		}
+
+		axes := slices.Sorted(maps.Keys(job.Matrix))
+		for _, axis := range axes {
+			if len(job.Matrix[axis]) == 0 {
+				return nil, fmt.Errorf("job %q: matrix axis %q has no values", job.Name, axis)
+			}
+		}
+
+		for _, combo := range matrixCombinations(axes, job.Matrix) {
+			j := job
+			j.Matrix = nil
+			j.matrixValues = combo
+			j.Name = matrixJobName(job.Name, axes, combo)
+			j.Env = maps.Clone(job.Env)
+			j.DependsOn = slices.Clone(job.DependsOn)
+			expanded = append(expanded, j)
+			groups[job.Name] = append(groups[job.Name], j.Name)
+		}
+	}
+	if len(groups) == 0 {
+		return expanded, nil
+	}
+
+	// Point dependencies on a group at its members
+	for i := range expanded {
+		var deps []ApplyDependency
+		for _, dep := range expanded[i].DependsOn {
+			members, isGroup := groups[dep.Name]
+			if !isGroup {
+				deps = append(deps, dep)
+				continue
+			}
+			for _, member := range members {
+				deps = append(deps, ApplyDependency{Name: member, Condition: dep.Condition})
+			}
+		}
+		expanded[i].DependsOn = deps
+	}
+	return expanded, nil
+}
+
+// matrixCombinations returns the cartesian product of the axis values, with
+// the first axis varying slowest
+func matrixCombinations(axes []string, matrix map[string][]string) []map[string]string {
+	combos := []map[string]string{{}}
+	for _, axis := range axes {
+		var next []map[string]string
+		for _, combo := range combos {
+			for _, value := range matrix[axis] {
+				c := maps.Clone(combo)
+				c[axis] = value
+				next = append(next, c)
+			}
+		}
+		combos = next
+	}
+	return combos
+}
+
+// matrixJobName builds the name of one expanded matrix job
+func matrixJobName(name string, axes []string, values map[string]string) string {
+	parts := make([]string, len(axes))
+	for i, axis := range axes {
+		parts[i] = axis + "=" + values[axis]
+	}
+	return name + "[" + strings.Join(parts, ",") + "]"
+}
@@ -0,0 +1,73 @@
+package queue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseApplyFileBytes_Matrix(t *testing.T) {
+	af, err := ParseApplyFileBytes([]byte(`
+jobs:
+  - name: build
+    command: "make GOOS={{ .matrix.os }} GOARCH={{ .matrix.arch }}"
+    matrix:
+      os: [linux, darwin]
+      arch: [amd64, arm64]
+  - name: release
+    command: "./release.sh"
+    depends_on:
+      - name: build
+`))
+	require.NoError(t, err)
+	require.NoError(t, af.Validate())
+	require.NoError(t, af.Render())
+
+	var names []string
+	for _, job := range af.Jobs {
+		names = append(names, job.Name)
+	}
+	assert.Equal(t, []string{
+		"build[arch=amd64,os=linux]",
+		"build[arch=amd64,os=darwin]",
+		"build[arch=arm64,os=linux]",
+		"build[arch=arm64,os=darwin]",
+		"release",
+	}, names)
+	assert.Equal(t, "make GOOS=darwin GOARCH=arm64", af.Jobs[3].Command)
+
+	// Depending on the group depends on every expanded job
+	release := af.Jobs[4]
+	require.Len(t, release.DependsOn, 4)
+	assert.Equal(t, ApplyDependency{Name: "build[arch=amd64,os=linux]", Condition: "succeeded"}, release.DependsOn[0])
+}
+
+func TestParseApplyFileBytes_MatrixEmptyAxis(t *testing.T) {
+	_, err := ParseApplyFileBytes([]byte(`
+jobs:
+  - name: worker
+    command: "echo"
+    matrix:
+      chunk: []
+`))
+	assert.EqualError(t, err, `job "worker": matrix axis "chunk" has no values`)
+}
+
+func TestValidate_MatrixCycle(t *testing.T) {
+	af, err := ParseApplyFileBytes([]byte(`
+jobs:
+  - name: a
+    command: "echo a"
+    matrix:
+      n: [1, 2]
+    depends_on:
+      - name: b
+  - name: b
+    command: "echo b"
+    depends_on:
+      - name: a
+`))
+	require.NoError(t, err)
+	assert.EqualError(t, af.Validate(), "dependency cycle detected")
+}
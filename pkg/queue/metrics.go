@@ -0,0 +1,253 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metricsWindow is how far back the server's job duration and failure
+// metrics look. Finished jobs are pruned from the database, so these are
+// reported over a fixed window rather than as counters.
+const metricsWindow = time.Hour
+
+// metricsScrapeTimeout bounds the queries run for a scrape
+const metricsScrapeTimeout = 10 * time.Second
+
+// jobDurationQuantiles are the quantiles of job durations the server reports
+var jobDurationQuantiles = []float64{0.5, 0.9, 0.99}
+
+var (
+	queueJobsDesc = prometheus.NewDesc("qq_queue_jobs",
+		"Jobs in the queue by state. Blocked jobs wait for their dependencies.",
+		[]string{"queue", "state"}, nil)
+	queuePausedDesc = prometheus.NewDesc("qq_queue_paused",
+		"Whether the queue is paused.",
+		[]string{"queue"}, nil)
+	queueLimitDesc = prometheus.NewDesc("qq_queue_global_limit",
+		"Running jobs allowed across all workers, 0 for no limit.",
+		[]string{"queue"}, nil)
+	jobsFinishedDesc = prometheus.NewDesc("qq_jobs_finished",
+		"Jobs that finished in the last hour by result.",
+		[]string{"queue", "result"}, nil)
+	jobFailureRatioDesc = prometheus.NewDesc("qq_job_failure_ratio",
+		"Share of the jobs that finished in the last hour that failed or were cancelled.",
+		[]string{"queue"}, nil)
+	jobDurationDesc = prometheus.NewDesc("qq_job_duration_seconds",
+		"Run time of the last attempt of jobs that finished in the last hour.",
+		[]string{"queue"}, nil)
+	workerHeartbeatAgeDesc = prometheus.NewDesc("qq_worker_heartbeat_age_seconds",
+		"Time since the worker's last heartbeat.",
+		[]string{"worker", "hostname"}, nil)
+	workerRunningJobsDesc = prometheus.NewDesc("qq_worker_running_jobs",
+		"Jobs the worker is running, as of its last heartbeat.",
+		[]string{"worker", "hostname"}, nil)
+	workerLostDesc = prometheus.NewDesc("qq_worker_lost",
+		"Whether the worker stopped heartbeating without shutting down.",
+		[]string{"worker", "hostname"}, nil)
+)
+
+// queueMetrics reports the state of all queues and workers from the
+// database on every scrape, for "qq server"
+type queueMetrics struct {
+	q *QueueClient
+}
+
+// QueueMetricsHandler returns an HTTP handler that serves queue depth, job
+// durations and failure rates, and worker heartbeat ages in the Prometheus
+// format. The database is queried on every scrape.
+func (q *QueueClient) QueueMetricsHandler() http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(&queueMetrics{q: q})
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// Describe implements prometheus.Collector
+func (m *queueMetrics) Describe(ch chan<- *prometheus.Desc) {
+	ch <- queueJobsDesc
+	ch <- queuePausedDesc
+	ch <- queueLimitDesc
+	ch <- jobsFinishedDesc
+	ch <- jobFailureRatioDesc
+	ch <- jobDurationDesc
+	ch <- workerHeartbeatAgeDesc
+	ch <- workerRunningJobsDesc
+	ch <- workerLostDesc
+}
+
+// Collect implements prometheus.Collector. A failed query fails the scrape,
+// so that missing series are not mistaken for empty queues.
+func (m *queueMetrics) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), metricsScrapeTimeout)
+	defer cancel()
+
+	if err := m.collectQueues(ctx, ch); err != nil {
+		ch <- prometheus.NewInvalidMetric(queueJobsDesc, err)
+	}
+	if err := m.collectFinishedJobs(ctx, ch); err != nil {
+		ch <- prometheus.NewInvalidMetric(jobDurationDesc, err)
+	}
+	if err := m.collectWorkers(ctx, ch); err != nil {
+		ch <- prometheus.NewInvalidMetric(workerHeartbeatAgeDesc, err)
+	}
+}
+
+func (m *queueMetrics) collectQueues(ctx context.Context, ch chan<- prometheus.Metric) error {
+	stats, err := m.q.GetQueueStats(ctx, "")
+	if err != nil {
+		return err
+	}
+	for _, s := range stats {
+		for _, state := range []struct {
+			name  string
+			count int
+		}{
+			{"pending", s.Pending},
+			{"blocked", s.Blocked},
+			{"running", s.Running},
+			{"completed", s.Completed},
+			{"failed", s.Failed},
+		} {
+			ch <- prometheus.MustNewConstMetric(queueJobsDesc, prometheus.GaugeValue, float64(state.count), s.Name, state.name)
+		}
+		ch <- prometheus.MustNewConstMetric(queuePausedDesc, prometheus.GaugeValue, boolValue(s.Paused), s.Name)
+		ch <- prometheus.MustNewConstMetric(queueLimitDesc, prometheus.GaugeValue, float64(s.GlobalLimit), s.Name)
+	}
+	return nil
+}
+
+func (m *queueMetrics) collectFinishedJobs(ctx context.Context, ch chan<- prometheus.Metric) error {
+	jobTableName, err := resolveJobTableName(ctx, m.q.pool)
+	if err != nil {
+		return err
+	}
+
+	// Jobs cancelled before they ran have no duration, but still count as
+	// failed
+	rows, err := m.q.pool.Query(ctx, fmt.Sprintf(`
+		SELECT
+			queue,
+			COUNT(*) FILTER (WHERE state = 'completed'),
+			COUNT(*) FILTER (WHERE state <> 'completed'),
+			COUNT(duration),
+			COALESCE(SUM(duration), 0),
+			percentile_cont($2::float8[]) WITHIN GROUP (ORDER BY duration)
+		FROM (
+			SELECT COALESCE(rt.queue, j.queue) AS queue, j.state, EXTRACT(EPOCH FROM j.finalized_at - j.attempted_at)::float8 AS duration
+			FROM %s j
+			LEFT JOIN queue_routes rt ON rt.name = j.queue
+			WHERE j.state IN ('completed', 'cancelled', 'discarded')
+				AND j.finalized_at > NOW() - make_interval(secs => $1)
+		) finished
+		GROUP BY queue
+		ORDER BY queue
+	`, jobTableName), metricsWindow.Seconds(), jobDurationQuantiles)
+	if err != nil {
+		return fmt.Errorf("failed to query finished jobs: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var queueName string
+		var succeeded, failed, timed int64
+		var sum float64
+		var quantiles []float64
+		if err := rows.Scan(&queueName, &succeeded, &failed, &timed, &sum, &quantiles); err != nil {
+			return fmt.Errorf("failed to scan finished jobs: %w", err)
+		}
+
+		ch <- prometheus.MustNewConstMetric(jobsFinishedDesc, prometheus.GaugeValue, float64(succeeded), queueName, "succeeded")
+		ch <- prometheus.MustNewConstMetric(jobsFinishedDesc, prometheus.GaugeValue, float64(failed), queueName, "failed")
+		ch <- prometheus.MustNewConstMetric(jobFailureRatioDesc, prometheus.GaugeValue, float64(failed)/float64(succeeded+failed), queueName)
+
+		if timed > 0 && len(quantiles) == len(jobDurationQuantiles) {
+			values := make(map[float64]float64, len(quantiles))
+			for i, quantile := range jobDurationQuantiles {
+				values[quantile] = quantiles[i]
+			}
+			ch <- prometheus.MustNewConstSummary(jobDurationDesc, uint64(timed), sum, values, queueName)
+		}
+	}
+	return rows.Err()
+}
+
+func (m *queueMetrics) collectWorkers(ctx context.Context, ch chan<- prometheus.Metric) error {
+	workers, err := m.q.ListWorkers(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, w := range workers {
+		ch <- prometheus.MustNewConstMetric(workerHeartbeatAgeDesc, prometheus.GaugeValue, now.Sub(w.HeartbeatAt).Seconds(), w.ID, w.Hostname)
+		ch <- prometheus.MustNewConstMetric(workerRunningJobsDesc, prometheus.GaugeValue, float64(len(w.RunningJobIDs)), w.ID, w.Hostname)
+		ch <- prometheus.MustNewConstMetric(workerLostDesc, prometheus.GaugeValue, boolValue(w.Lost), w.ID, w.Hostname)
+	}
+	return nil
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// jobMetrics records the jobs a worker process runs, for "qq worker
+// --metrics-addr"
+type jobMetrics struct {
+	registry    *prometheus.Registry
+	duration    *prometheus.HistogramVec
+	exitCodes   *prometheus.CounterVec
+	outputBytes *prometheus.HistogramVec
+}
+
+func newJobMetrics() *jobMetrics {
+	m := &jobMetrics{
+		registry: prometheus.NewRegistry(),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "qq_worker_job_duration_seconds",
+			Help:    "Run time of the job attempts this worker ran.",
+			Buckets: []float64{0.1, 0.5, 1, 5, 15, 30, 60, 300, 900, 1800, 3600, 7200},
+		}, []string{"queue"}),
+		exitCodes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "qq_worker_job_exit_codes_total",
+			Help: "Job attempts this worker ran by exit code. Cancelled and interrupted jobs exit with 130, timed out jobs with 124.",
+		}, []string{"queue", "exit_code"}),
+		outputBytes: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "qq_worker_job_output_bytes",
+			Help:    "Size of the output of the job attempts this worker ran.",
+			Buckets: prometheus.ExponentialBuckets(256, 4, 9), // 256B to 16MiB
+		}, []string{"queue"}),
+	}
+	m.registry.MustRegister(
+		m.duration,
+		m.exitCodes,
+		m.outputBytes,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// observe records a job attempt that ran its command
+func (m *jobMetrics) observe(queueName string, duration time.Duration, exitCode int, outputBytes int) {
+	m.duration.WithLabelValues(queueName).Observe(duration.Seconds())
+	m.exitCodes.WithLabelValues(queueName, strconv.Itoa(exitCode)).Inc()
+	m.outputBytes.WithLabelValues(queueName).Observe(float64(outputBytes))
+}
+
+// WorkerMetricsHandler returns an HTTP handler that serves the worker's job
+// execution metrics in the Prometheus format. It is nil for insert-only
+// clients.
+func (q *QueueClient) WorkerMetricsHandler() http.Handler {
+	if q.metrics == nil {
+		return nil
+	}
+	return promhttp.HandlerFor(q.metrics.registry, promhttp.HandlerOpts{})
+}
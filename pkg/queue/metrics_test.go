@@ -0,0 +1,39 @@
+package queue
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBashWorker_RecordsMetrics(t *testing.T) {
+	w := &BashWorker{metrics: newJobMetrics()}
+	work := func(command string) {
+		_ = w.Work(context.Background(), &river.Job[BashJobArgs]{
+			JobRow: &rivertype.JobRow{ID: 1, Attempt: 1, Queue: "ci"},
+			Args:   BashJobArgs{Command: command},
+		})
+	}
+	work("printf hello")
+	work("exit 3")
+	work("exit 3")
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(w.metrics.exitCodes.WithLabelValues("ci", "0")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(w.metrics.exitCodes.WithLabelValues("ci", "3")))
+	assert.Equal(t, uint64(3), histogramCount(t, w.metrics.duration.WithLabelValues("ci")))
+	assert.Equal(t, uint64(3), histogramCount(t, w.metrics.outputBytes.WithLabelValues("ci")))
+}
+
+func histogramCount(t *testing.T, o prometheus.Observer) uint64 {
+	t.Helper()
+	var m dto.Metric
+	require.NoError(t, o.(prometheus.Metric).Write(&m))
+	return m.GetHistogram().GetSampleCount()
+}
@@ -0,0 +1,267 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// outputFlushInterval is how often a running job's new output is appended
+// to job_output_chunks
+const outputFlushInterval = 500 * time.Millisecond
+
+// Output streams recorded in job_output_chunks
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+// OutputChunk is a piece of a job attempt's output as it was streamed.
+// CreatedAt is when the first byte of the chunk was written.
+type OutputChunk struct {
+	Seq       int
+	Stream    string
+	Data      string
+	CreatedAt time.Time
+}
+
+// outputSegment is output from one stream that has not been flushed yet
+type outputSegment struct {
+	stream string
+	data   []byte
+	at     time.Time
+}
+
+// outputStream collects a command's stdout and stderr and periodically
+// appends what is new to job_output_chunks, so followers can watch a job
+// while it runs. Each chunk holds output from a single stream.
+type outputStream struct {
+	pool    *pgxpool.Pool
+	jobID   int64
+	attempt int
+
+	mu      sync.Mutex
+	all     bytes.Buffer
+	pending []outputSegment
+
+	flushMu sync.Mutex
+	seq     int
+	carry   map[string][]byte // partial UTF-8 sequences held back per stream
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// streamWriter writes to one stream of an outputStream
+type streamWriter struct {
+	s      *outputStream
+	stream string
+}
+
+// Write implements io.Writer
+func (w streamWriter) Write(p []byte) (int, error) {
+	w.s.write(w.stream, p)
+	return len(p), nil
+}
+
+// newOutputStream starts a stream for one attempt of a job. The caller must
+// call Close once the command has exited.
+func newOutputStream(ctx context.Context, pool *pgxpool.Pool, jobID int64, attempt int) *outputStream {
+	s := &outputStream{
+		pool:    pool,
+		jobID:   jobID,
+		attempt: attempt,
+		carry:   make(map[string][]byte),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	// A job interrupted by a worker shutdown runs again as the same attempt,
+	// so chunks of the interrupted run may already be stored. They are
+	// replaced, and numbering continues after them so that followers keep
+	// reading from where they were.
+	if pool != nil {
+		seq, err := clearOutputChunks(ctx, pool, jobID, attempt)
+		if err != nil {
+			fmt.Println("Failed to clear earlier job output chunks:", err)
+		}
+		s.seq = seq
+	}
+
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(outputFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.flush(ctx, false)
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+
+	return s
+}
+
+// Stdout returns a writer for the command's standard output
+func (s *outputStream) Stdout() io.Writer { return streamWriter{s, StreamStdout} }
+
+// Stderr returns a writer for the command's standard error
+func (s *outputStream) Stderr() io.Writer { return streamWriter{s, StreamStderr} }
+
+func (s *outputStream) write(stream string, p []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.all.Write(p)
+	if n := len(s.pending); n > 0 && s.pending[n-1].stream == stream {
+		s.pending[n-1].data = append(s.pending[n-1].data, p...)
+		return
+	}
+	s.pending = append(s.pending, outputSegment{
+		stream: stream,
+		data:   append([]byte(nil), p...),
+		at:     time.Now(),
+	})
+}
+
+// String returns all output written so far, both streams interleaved
+func (s *outputStream) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.all.String()
+}
+
+// Close stops the periodic flushing and writes any remaining output
+func (s *outputStream) Close(ctx context.Context) {
+	close(s.stop)
+	<-s.done
+	s.flush(ctx, true)
+}
+
+// flush appends pending output as new chunks, one per segment. Unless final,
+// a trailing partial UTF-8 sequence is held back until the rest arrives.
+func (s *outputStream) flush(ctx context.Context, final bool) {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	s.mu.Lock()
+	segments := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+
+	batch := &pgx.Batch{}
+	queueChunk := func(stream string, data []byte, at time.Time) {
+		if len(data) == 0 {
+			return
+		}
+		s.seq++
+		batch.Queue(`
+			INSERT INTO job_output_chunks (job_id, attempt, seq, stream, data, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (job_id, attempt, seq) DO NOTHING
+		`, s.jobID, s.attempt, s.seq, stream, sanitizeOutput(string(data)), at)
+	}
+
+	for _, seg := range segments {
+		data := append(s.carry[seg.stream], seg.data...)
+		s.carry[seg.stream] = nil
+		if !final {
+			data, s.carry[seg.stream] = splitIncompleteRune(data)
+		}
+		queueChunk(seg.stream, data, seg.at)
+	}
+
+	if final {
+		// Whatever is still held back will never be completed
+		for stream, rest := range s.carry {
+			queueChunk(stream, rest, time.Now())
+		}
+		s.carry = make(map[string][]byte)
+	}
+
+	if batch.Len() == 0 || s.pool == nil {
+		return
+	}
+	if err := s.pool.SendBatch(ctx, batch).Close(); err != nil {
+		fmt.Println("Failed to save job output chunks:", err)
+	}
+}
+
+// clearOutputChunks deletes the chunks stored for an attempt of a job and
+// returns the highest seq among them, 0 if there were none
+func clearOutputChunks(ctx context.Context, pool *pgxpool.Pool, jobID int64, attempt int) (int, error) {
+	var seq int
+	err := pool.QueryRow(ctx, `
+		WITH deleted AS (
+			DELETE FROM job_output_chunks
+			WHERE job_id = $1 AND attempt = $2
+			RETURNING seq
+		)
+		SELECT COALESCE(MAX(seq), 0) FROM deleted
+	`, jobID, attempt).Scan(&seq)
+	if err != nil {
+		return 0, fmt.Errorf("failed to clear job output chunks: %w", err)
+	}
+	return seq, nil
+}
+
+// splitIncompleteRune splits b before a trailing incomplete UTF-8 sequence.
+// The returned rest is a fresh slice so the caller can keep appending to it.
+func splitIncompleteRune(b []byte) (complete, rest []byte) {
+	// A UTF-8 sequence is at most utf8.UTFMax bytes, so only the last few
+	// bytes can belong to an unfinished rune
+	for i := 1; i < utf8.UTFMax && i <= len(b); i++ {
+		c := b[len(b)-i]
+		if !utf8.RuneStart(c) {
+			continue
+		}
+		if !utf8.FullRune(b[len(b)-i:]) {
+			return b[:len(b)-i], append([]byte(nil), b[len(b)-i:]...)
+		}
+		break
+	}
+	return b, nil
+}
+
+// sanitizeOutput makes command output storable in a Postgres TEXT column,
+// which rejects invalid UTF-8 and NUL bytes
+func sanitizeOutput(s string) string {
+	s = strings.ToValidUTF8(s, "�")
+	return strings.ReplaceAll(s, "\x00", "")
+}
+
+// GetOutputChunks retrieves the output chunks of a job attempt that come
+// after the given sequence number, in order. Followers pass the last Seq
+// they have seen to read only what is new.
+func (q *QueueClient) GetOutputChunks(ctx context.Context, jobID int64, attempt int, afterSeq int) ([]OutputChunk, error) {
+	rows, err := q.pool.Query(ctx, `
+		SELECT seq, stream, data, created_at
+		FROM job_output_chunks
+		WHERE job_id = $1 AND attempt = $2 AND seq > $3
+		ORDER BY seq
+	`, jobID, attempt, afterSeq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query output chunks: %w", err)
+	}
+	defer rows.Close()
+
+	var chunks []OutputChunk
+	for rows.Next() {
+		var c OutputChunk
+		if err := rows.Scan(&c.Seq, &c.Stream, &c.Data, &c.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan output chunk: %w", err)
+		}
+		chunks = append(chunks, c)
+	}
+	return chunks, rows.Err()
+}
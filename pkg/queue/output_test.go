@@ -0,0 +1,48 @@
+package queue
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitIncompleteRune(t *testing.T) {
+	euro := []byte("€") // 3 bytes
+
+	complete, rest := splitIncompleteRune([]byte("abc"))
+	assert.Equal(t, "abc", string(complete))
+	assert.Empty(t, rest)
+
+	complete, rest = splitIncompleteRune(append([]byte("price: "), euro[:2]...))
+	assert.Equal(t, "price: ", string(complete))
+	assert.Equal(t, euro[:2], rest)
+
+	complete, rest = splitIncompleteRune(append([]byte("price: "), euro...))
+	assert.Equal(t, "price: €", string(complete))
+	assert.Empty(t, rest)
+}
+
+func TestSanitizeOutput(t *testing.T) {
+	assert.Equal(t, "ab", sanitizeOutput("a\x00b"))
+	assert.Equal(t, "a�b", sanitizeOutput("a\xffb"))
+}
+
+func TestOutputStream_CollectsOutput(t *testing.T) {
+	s := newOutputStream(context.Background(), nil, 1, 1)
+	_, _ = s.Stdout().Write([]byte("hello "))
+	_, _ = s.Stderr().Write([]byte("oops\n"))
+	_, _ = s.Stdout().Write([]byte("world\n"))
+
+	// Consecutive writes to the same stream share a segment
+	s.mu.Lock()
+	streams := []string{}
+	for _, seg := range s.pending {
+		streams = append(streams, seg.stream)
+	}
+	s.mu.Unlock()
+	assert.Equal(t, []string{StreamStdout, StreamStderr, StreamStdout}, streams)
+
+	s.Close(context.Background())
+	assert.Equal(t, "hello oops\nworld\n", s.String())
+}
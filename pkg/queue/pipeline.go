@@ -0,0 +1,372 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// defaultPipelineName is used for pipelines that have neither a name in
+// their YAML nor a file to be named after
+const defaultPipelineName = "pipeline"
+
+// Overall states of a pipeline run
+const (
+	PipelineStatePending   = "pending"
+	PipelineStateRunning   = "running"
+	PipelineStateSucceeded = "succeeded"
+	PipelineStateFailed    = "failed"
+)
+
+// PipelineRun is one submission of a pipeline file with "qq apply"
+type PipelineRun struct {
+	ID          int64
+	Name        string
+	RunKey      string            // set when the run was applied with a run key
+	Source      string            // the submitted YAML
+	Vars        map[string]string // the variables Source was rendered with
+	SubmittedAt time.Time
+	State       string // overall state, one of the PipelineState constants
+	Attempts    int    // 1 plus the number of times the run was retried
+	Jobs        []PipelineRunJob
+}
+
+// PipelineRunJob is a job of a pipeline run, listed under its YAML name.
+// When the run was retried it is the latest job for that name.
+type PipelineRunJob struct {
+	Name       string
+	JobID      int64
+	Queue      string
+	State      string // River job state
+	Deleted    bool   // River has deleted the job; State is its final state
+	Attempt    int
+	ExitCode   int
+	Reason     string
+	RunAttempt int // the run attempt that enqueued the job
+}
+
+// addPipelineRunTx records a pipeline run and its jobs within the
+// transaction that inserted them, and returns the run ID
+func addPipelineRunTx(ctx context.Context, tx pgx.Tx, af *ApplyFile, results []ApplyResult) (int64, error) {
+	name := af.Name
+	if name == "" {
+		name = defaultPipelineName
+	}
+
+	// The variables are kept so that a retry renders the source the same way
+	var runID int64
+	err := tx.QueryRow(ctx, `
+		INSERT INTO pipeline_runs (name, source, vars, run_key)
+		VALUES ($1, $2, $3, NULLIF($4, ''))
+		RETURNING id
+	`, name, string(af.source), af.Vars, af.RunKey).Scan(&runID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := addPipelineRunJobsTx(ctx, tx, runID, 1, af, results); err != nil {
+		return 0, err
+	}
+	return runID, nil
+}
+
+// addPipelineRunJobsTx links jobs inserted for attempt of a run to the run,
+// keeping the order they have in the pipeline file
+func addPipelineRunJobsTx(ctx context.Context, tx pgx.Tx, runID int64, attempt int, af *ApplyFile, results []ApplyResult) error {
+	position := make(map[string]int, len(af.Jobs))
+	for i, job := range af.Jobs {
+		position[job.Name] = i
+	}
+
+	for _, r := range results {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO pipeline_run_jobs (run_id, job_id, name, position, attempt)
+			VALUES ($1, $2, $3, $4, $5)
+		`, runID, r.JobID, r.Name, position[r.Name], attempt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// activePipelineRunTx returns the most recent run with runKey that still has
+// unfinished jobs, or 0 if there is none. It first locks the key until tx
+// ends, so that concurrent applies with the same key insert one run.
+func (q *QueueClient) activePipelineRunTx(ctx context.Context, tx pgx.Tx, runKey string) (int64, error) {
+	jobTableName, err := resolveJobTableName(ctx, q.pool)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('qq.run_key'), hashtext($1))`, runKey); err != nil {
+		return 0, err
+	}
+
+	// Retries only add jobs to finished runs, so a run is unfinished exactly
+	// when one of its jobs is
+	var runID int64
+	err = tx.QueryRow(ctx, fmt.Sprintf(`
+		SELECT p.id
+		FROM pipeline_runs p
+		WHERE p.run_key = $1 AND EXISTS (
+			SELECT 1
+			FROM pipeline_run_jobs pj
+			JOIN %s j ON j.id = pj.job_id
+			WHERE pj.run_id = p.id
+				AND j.state NOT IN ('completed', 'cancelled', 'discarded')
+		)
+		ORDER BY p.id DESC
+		LIMIT 1
+	`, jobTableName), runKey).Scan(&runID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	return runID, err
+}
+
+// existingPipelineRunResults returns the current jobs of a run as the
+// result of applying it again
+func (q *QueueClient) existingPipelineRunResults(ctx context.Context, runID int64) ([]ApplyResult, error) {
+	run, err := q.GetPipelineRun(ctx, runID)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]ApplyResult, 0, len(run.Jobs))
+	for _, job := range run.Jobs {
+		results = append(results, ApplyResult{
+			Name:     job.Name,
+			JobID:    job.JobID,
+			Queue:    job.Queue,
+			RunID:    runID,
+			Existing: true,
+		})
+	}
+	return results, nil
+}
+
+// pipelineRunState derives the overall state of a run from the states of
+// its jobs. Jobs River has already deleted count as finished.
+func pipelineRunState(states []string) string {
+	finished, failed, started := 0, false, false
+	for _, state := range states {
+		switch state {
+		case "available", "scheduled", "pending":
+		case "running", "retryable":
+			started = true
+		case "cancelled", "discarded":
+			finished++
+			failed = true
+		default:
+			finished++
+		}
+	}
+
+	switch {
+	case finished == len(states) && failed:
+		return PipelineStateFailed
+	case finished == len(states):
+		return PipelineStateSucceeded
+	case started || finished > 0:
+		return PipelineStateRunning
+	default:
+		return PipelineStatePending
+	}
+}
+
+// ListPipelineRuns retrieves the most recent pipeline runs, without their
+// jobs or source
+func (q *QueueClient) ListPipelineRuns(ctx context.Context, limit int) ([]PipelineRun, error) {
+	jobTableName, err := resolveJobTableName(ctx, q.pool)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each job name counts with the job of its latest run attempt
+	rows, err := q.pool.Query(ctx, fmt.Sprintf(`
+		WITH runs AS (
+			SELECT id, name, submitted_at
+			FROM pipeline_runs
+			ORDER BY id DESC
+			LIMIT $1
+		),
+		latest AS (
+			SELECT DISTINCT ON (pj.run_id, pj.name)
+				pj.run_id, pj.job_id, pj.position, pj.attempt, pj.final_state
+			FROM pipeline_run_jobs pj
+			JOIN runs ON runs.id = pj.run_id
+			ORDER BY pj.run_id, pj.name, pj.attempt DESC
+		)
+		SELECT
+			p.id,
+			p.name,
+			p.submitted_at,
+			COALESCE(MAX(l.attempt), 1),
+			COALESCE(array_agg(COALESCE(j.state::text, l.final_state, 'deleted') ORDER BY l.position)
+				FILTER (WHERE l.job_id IS NOT NULL), '{}')
+		FROM runs p
+		LEFT JOIN latest l ON l.run_id = p.id
+		LEFT JOIN %s j ON j.id = l.job_id
+		GROUP BY p.id, p.name, p.submitted_at
+		ORDER BY p.id DESC
+	`, jobTableName), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pipeline runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []PipelineRun
+	for rows.Next() {
+		var run PipelineRun
+		var states []string
+		if err := rows.Scan(&run.ID, &run.Name, &run.SubmittedAt, &run.Attempts, &states); err != nil {
+			return nil, fmt.Errorf("failed to scan pipeline run: %w", err)
+		}
+		run.State = pipelineRunState(states)
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// GetPipelineRun retrieves a pipeline run with its source and the current
+// state of each of its jobs
+func (q *QueueClient) GetPipelineRun(ctx context.Context, runID int64) (*PipelineRun, error) {
+	jobTableName, err := resolveJobTableName(ctx, q.pool)
+	if err != nil {
+		return nil, err
+	}
+
+	run := &PipelineRun{ID: runID}
+	err = q.pool.QueryRow(ctx, `
+		SELECT name, COALESCE(run_key, ''), source, COALESCE(vars, '{}'), submitted_at
+		FROM pipeline_runs
+		WHERE id = $1
+	`, runID).Scan(&run.Name, &run.RunKey, &run.Source, &run.Vars, &run.SubmittedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("pipeline run %d not found", runID)
+		}
+		return nil, fmt.Errorf("failed to get pipeline run: %w", err)
+	}
+
+	rows, err := q.pool.Query(ctx, fmt.Sprintf(`
+		WITH latest AS (
+			SELECT DISTINCT ON (name) name, job_id, position, attempt, final_state
+			FROM pipeline_run_jobs
+			WHERE run_id = $1
+			ORDER BY name, attempt DESC
+		)
+		SELECT
+			pj.name,
+			pj.job_id,
+			COALESCE(rt.queue, j.queue, ''),
+			COALESCE(j.state::text, pj.final_state, 'deleted'),
+			j.id IS NULL,
+			COALESCE(j.attempt, 0),
+			r.exit_code,
+			r.reason,
+			pj.attempt
+		FROM latest pj
+		LEFT JOIN %s j ON j.id = pj.job_id
+		LEFT JOIN job_results r ON r.job_id = pj.job_id AND r.attempt = j.attempt
+		LEFT JOIN queue_routes rt ON rt.name = j.queue
+		ORDER BY pj.position
+	`, jobTableName), runID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pipeline jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var states []string
+	run.Attempts = 1
+	for rows.Next() {
+		var job PipelineRunJob
+		var exitCode sql.NullInt32
+		var reason sql.NullString
+		if err := rows.Scan(&job.Name, &job.JobID, &job.Queue, &job.State, &job.Deleted, &job.Attempt, &exitCode, &reason, &job.RunAttempt); err != nil {
+			return nil, fmt.Errorf("failed to scan pipeline job: %w", err)
+		}
+		job.ExitCode = int(exitCode.Int32)
+		job.Reason = reason.String
+		run.Attempts = max(run.Attempts, job.RunAttempt)
+		run.Jobs = append(run.Jobs, job)
+		states = append(states, job.State)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	run.State = pipelineRunState(states)
+	return run, nil
+}
+
+// RetryPipelineRun re-enqueues the jobs of a finished run that did not
+// succeed: failed, cancelled and never-run jobs. Jobs that succeeded are
+// kept and satisfy the dependencies of the re-enqueued ones. The new jobs
+// are linked to the run under its next attempt number.
+func (q *QueueClient) RetryPipelineRun(ctx context.Context, runID int64) ([]ApplyResult, error) {
+	run, err := q.GetPipelineRun(ctx, runID)
+	if err != nil {
+		return nil, err
+	}
+	switch run.State {
+	case PipelineStatePending, PipelineStateRunning:
+		return nil, fmt.Errorf("pipeline run %d is still %s", runID, run.State)
+	case PipelineStateSucceeded:
+		return nil, fmt.Errorf("pipeline run %d succeeded, nothing to retry", runID)
+	}
+
+	af, err := ParseApplyFileBytes([]byte(run.Source))
+	if err != nil {
+		return nil, err
+	}
+	af.Name = run.Name
+	af.Vars = run.Vars
+	if err := af.Validate(); err != nil {
+		return nil, fmt.Errorf("validation error: %w", err)
+	}
+	if err := af.Render(); err != nil {
+		return nil, fmt.Errorf("validation error: %w", err)
+	}
+
+	// Start from the jobs that succeeded. Those River has already deleted
+	// map to ID 0: they satisfy dependencies without a dependency row.
+	nameToID := make(map[string]int64)
+	for _, job := range run.Jobs {
+		if job.State != "completed" {
+			continue
+		}
+		if job.Deleted {
+			nameToID[job.Name] = 0
+		} else {
+			nameToID[job.Name] = job.JobID
+		}
+	}
+
+	tx, err := q.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	results, err := q.insertPipelineJobsTx(ctx, tx, af, nameToID)
+	if err != nil {
+		return nil, err
+	}
+	// A concurrent retry of the same run fails here on the primary key
+	if err := addPipelineRunJobsTx(ctx, tx, runID, run.Attempts+1, af, results); err != nil {
+		return nil, fmt.Errorf("failed to record pipeline run: %w", err)
+	}
+	for i := range results {
+		results[i].RunID = runID
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return results, nil
+}
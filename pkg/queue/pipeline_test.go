@@ -0,0 +1,37 @@
+package queue
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipelineRunState(t *testing.T) {
+	assert.Equal(t, PipelineStatePending, pipelineRunState([]string{"available", "pending"}))
+	assert.Equal(t, PipelineStateRunning, pipelineRunState([]string{"running", "pending"}))
+	assert.Equal(t, PipelineStateRunning, pipelineRunState([]string{"completed", "pending"}))
+	assert.Equal(t, PipelineStateSucceeded, pipelineRunState([]string{"completed", "completed"}))
+	assert.Equal(t, PipelineStateFailed, pipelineRunState([]string{"completed", "discarded", "cancelled"}))
+}
+
+func TestParseApplyFile_Name(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "nightly-etl.yaml")
+	source := "jobs:\n  - name: a\n    command: echo a\n"
+	require.NoError(t, os.WriteFile(path, []byte(source), 0o644))
+
+	// Named after the file by default
+	af, err := ParseApplyFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "nightly-etl", af.Name)
+	assert.Equal(t, source, string(af.source))
+
+	// A name in the YAML wins
+	require.NoError(t, os.WriteFile(path, []byte("name: etl\n"+source), 0o644))
+	af, err = ParseApplyFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "etl", af.Name)
+}
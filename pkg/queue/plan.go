@@ -0,0 +1,96 @@
+package queue
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Plan returns the jobs of a validated and rendered pipeline grouped into
+// levels: every job of a level can run in parallel once the jobs of the
+// earlier levels have finished.
+func (af *ApplyFile) Plan() ([][]ApplyJob, error) {
+	levels, err := topologicalLevels(af.Jobs)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := make([][]ApplyJob, len(levels))
+	for i, level := range levels {
+		for _, idx := range level {
+			plan[i] = append(plan[i], af.Jobs[idx])
+		}
+	}
+	return plan, nil
+}
+
+// DOT renders the dependency graph in Graphviz DOT format. Edges point from
+// a dependency to the job waiting for it; "finished" edges are dashed.
+func (af *ApplyFile) DOT() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %s {\n", dotQuote(af.graphName()))
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box];\n")
+	for _, job := range af.Jobs {
+		fmt.Fprintf(&b, "  %s [label=%s];\n", dotQuote(job.Name), dotQuote(job.Name+"\n"+job.Queue))
+	}
+	for _, job := range af.Jobs {
+		for _, dep := range job.DependsOn {
+			fmt.Fprintf(&b, "  %s -> %s", dotQuote(dep.Name), dotQuote(job.Name))
+			if dep.Condition == "finished" {
+				b.WriteString(" [style=dashed, label=\"finished\"]")
+			}
+			b.WriteString(";\n")
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// Mermaid renders the dependency graph as a Mermaid flowchart. Job names
+// can contain characters Mermaid doesn't allow in node IDs, so nodes are
+// numbered and labelled with the name.
+func (af *ApplyFile) Mermaid() string {
+	ids := make(map[string]string, len(af.Jobs))
+	for i, job := range af.Jobs {
+		ids[job.Name] = fmt.Sprintf("j%d", i)
+	}
+
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	for _, job := range af.Jobs {
+		fmt.Fprintf(&b, "  %s[\"%s<br/>%s\"]\n", ids[job.Name], mermaidEscape(job.Name), mermaidEscape(job.Queue))
+	}
+	for _, job := range af.Jobs {
+		for _, dep := range job.DependsOn {
+			if dep.Condition == "finished" {
+				fmt.Fprintf(&b, "  %s -. finished .-> %s\n", ids[dep.Name], ids[job.Name])
+			} else {
+				fmt.Fprintf(&b, "  %s --> %s\n", ids[dep.Name], ids[job.Name])
+			}
+		}
+	}
+	return b.String()
+}
+
+func (af *ApplyFile) graphName() string {
+	if af.Name == "" {
+		return defaultPipelineName
+	}
+	return af.Name
+}
+
+// dotQuote quotes s as a DOT string, where "\n" starts a new label line
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
+
+// mermaidEscape escapes the characters that end or break a quoted label
+func mermaidEscape(s string) string {
+	s = strings.ReplaceAll(s, `"`, "#quot;")
+	s = strings.ReplaceAll(s, "<", "#lt;")
+	s = strings.ReplaceAll(s, ">", "#gt;")
+	return s
+}
@@ -0,0 +1,88 @@
+package queue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const planTestPipeline = `
+name: release
+jobs:
+  - name: build
+    command: "make"
+    queue: ci
+  - name: lint
+    command: "make lint"
+  - name: test
+    command: "make test"
+    depends_on:
+      - name: build
+  - name: notify
+    command: "./notify.sh"
+    depends_on:
+      - name: test
+        condition: finished
+      - name: lint
+`
+
+func TestPlan(t *testing.T) {
+	af, err := ParseApplyFileBytes([]byte(planTestPipeline))
+	require.NoError(t, err)
+
+	plan, err := af.Plan()
+	require.NoError(t, err)
+
+	var names [][]string
+	for _, level := range plan {
+		var levelNames []string
+		for _, job := range level {
+			levelNames = append(levelNames, job.Name)
+		}
+		names = append(names, levelNames)
+	}
+	assert.Equal(t, [][]string{{"build", "lint"}, {"test"}, {"notify"}}, names)
+}
+
+func TestPlan_Cycle(t *testing.T) {
+	af := &ApplyFile{Jobs: []ApplyJob{
+		{Name: "a", Command: "echo a", DependsOn: []ApplyDependency{{Name: "b", Condition: "succeeded"}}},
+		{Name: "b", Command: "echo b", DependsOn: []ApplyDependency{{Name: "a", Condition: "succeeded"}}},
+	}}
+	_, err := af.Plan()
+	assert.EqualError(t, err, "dependency cycle detected")
+}
+
+func TestDOT(t *testing.T) {
+	af, err := ParseApplyFileBytes([]byte(planTestPipeline))
+	require.NoError(t, err)
+
+	assert.Equal(t, `digraph "release" {
+  rankdir=LR;
+  node [shape=box];
+  "build" [label="build\nci"];
+  "lint" [label="lint\ndefault"];
+  "test" [label="test\ndefault"];
+  "notify" [label="notify\ndefault"];
+  "build" -> "test";
+  "test" -> "notify" [style=dashed, label="finished"];
+  "lint" -> "notify";
+}
+`, af.DOT())
+}
+
+func TestMermaid(t *testing.T) {
+	af, err := ParseApplyFileBytes([]byte(planTestPipeline))
+	require.NoError(t, err)
+
+	assert.Equal(t, `flowchart LR
+  j0["build<br/>ci"]
+  j1["lint<br/>default"]
+  j2["test<br/>default"]
+  j3["notify<br/>default"]
+  j0 --> j2
+  j2 -. finished .-> j3
+  j1 --> j3
+`, af.Mermaid())
+}
@@ -0,0 +1,49 @@
+//go:build !windows
+
+package queue
+
+import (
+	"bufio"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKillProcessGroup_KillsChildren(t *testing.T) {
+	// bash ignores SIGTERM here and its background child holds the output
+	// pipe open, so only a group-wide SIGKILL lets Wait return.
+	cmd := exec.Command("bash", "-c", "trap '' TERM; sleep 30 & echo ready; wait")
+	setProcessGroup(cmd)
+	stdout, err := cmd.StdoutPipe()
+	require.NoError(t, err)
+	require.NoError(t, cmd.Start())
+
+	// Wait until the trap is installed before signalling
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "ready\n", line)
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	require.NoError(t, terminateProcessGroup(cmd))
+	select {
+	case <-done:
+		t.Fatal("command exited on SIGTERM despite trapping it")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	require.NoError(t, killProcessGroup(cmd))
+	select {
+	case err := <-done:
+		assert.Error(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("process group was not killed")
+	}
+
+	// Signalling a group that is gone is not an error
+	assert.NoError(t, killProcessGroup(cmd))
+}
@@ -0,0 +1,30 @@
+//go:build windows
+
+package queue
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// setProcessGroup is a no-op on Windows, which has no POSIX process groups
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// terminateProcessGroup kills the command's process. Windows has no SIGTERM,
+// so there is no graceful phase.
+func terminateProcessGroup(cmd *exec.Cmd) error {
+	return killProcessGroup(cmd)
+}
+
+// killProcessGroup kills the command's process
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	err := cmd.Process.Kill()
+	if errors.Is(err, os.ErrProcessDone) {
+		return nil
+	}
+	return err
+}
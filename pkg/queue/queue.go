@@ -3,44 +3,149 @@ package queue
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"os/exec"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/riverqueue/river"
 	"github.com/riverqueue/river/riverdriver/riverpgxv5"
+	"github.com/riverqueue/river/rivertype"
 
 	"qq/pkg/database"
 )
 
 // BashJobArgs defines a job that executes a bash command
 type BashJobArgs struct {
-	Command string `json:"command"`
+	Command        string            `json:"command"`
+	Env            map[string]string `json:"env,omitempty"`
+	Workdir        string            `json:"workdir,omitempty"`
+	TimeoutSeconds int               `json:"timeout_seconds,omitempty"`
+	Retry          *RetryPolicy      `json:"retry,omitempty"`
+
+	// Requires holds requirements on the labels of the worker that runs
+	// the job, see MatchLabels
+	Requires []string `json:"requires,omitempty"`
+
+	// UniqueKey makes River skip inserting the job while another job with
+	// the same key has not finished, see uniqueJobOpts
+	UniqueKey string `json:"unique_key,omitempty" river:"unique"`
 }
 
 // Kind returns the job kind
 func (j BashJobArgs) Kind() string { return "bash_command" }
 
+// Exit codes recorded in job_results when qq, rather than the command
+// itself, ended a job. They follow the shell convention for signals.
+const (
+	ExitCodeTimeout   = 124
+	ExitCodeCancelled = 130
+)
+
+// Reasons recorded in job_results alongside the exit code
+const (
+	ReasonTimeout     = "timeout"
+	ReasonCancelled   = "cancelled"
+	ReasonInterrupted = "interrupted"
+)
+
+// defaultKillGracePeriod is how long a command gets to exit after SIGTERM
+// before its process group is sent SIGKILL.
+const defaultKillGracePeriod = 10 * time.Second
+
+// queueSlotRetryInterval is how long a job of a queue at its global limit
+// waits before it is tried again
+const queueSlotRetryInterval = 2 * time.Second
+
 // BashWorker implements a worker for BashJobArgs
 type BashWorker struct {
-	pool         *pgxpool.Pool
-	jobTableName string
+	pool            *pgxpool.Pool
+	jobTableName    string
+	killGracePeriod time.Duration
+	defaultTimeout  time.Duration
+	queueTimeouts   map[string]time.Duration
+	envAllowlist    []string
+
+	// slots caps the jobs running at once across all of the worker's
+	// queues. Nil means no cap.
+	slots chan struct{}
+
+	// queueSlots caps the jobs running at once from each queue and its
+	// routes together. A queue without an entry has no cap beyond River's.
+	queueSlots map[string]chan struct{}
+
+	// router maps the routes the worker processes to their queues. Nil
+	// means the worker processes no routes.
+	router *queueRouter
+
+	// jobs tracks the running and completed jobs for the worker's
+	// heartbeat. Nil means they are not tracked.
+	jobs *jobTracker
+
+	// labels are what jobs' requirements are matched against
+	labels map[string]string
+
+	// metrics records the jobs the worker runs. Nil means they are not
+	// recorded.
+	metrics *jobMetrics
 	river.WorkerDefaults[BashJobArgs]
 }
 
+// Timeout disables River's job timeout. Work sets the job's deadline itself
+// once its command starts, so that the time a job spends waiting for a slot
+// doesn't count against it.
+func (w *BashWorker) Timeout(job *river.Job[BashJobArgs]) time.Duration {
+	return -1
+}
+
+// runTimeout returns how long the job's command may run before its process
+// tree is killed: the job's own timeout, else its queue's default, else the
+// worker default. Jobs with none of these run without a deadline.
+func (w *BashWorker) runTimeout(job *river.Job[BashJobArgs]) time.Duration {
+	if job.Args.TimeoutSeconds > 0 {
+		return time.Duration(job.Args.TimeoutSeconds) * time.Second
+	}
+	if d, ok := w.queueTimeouts[w.router.queueName(job.Queue)]; ok && d > 0 {
+		return d
+	}
+	if w.defaultTimeout > 0 {
+		return w.defaultTimeout
+	}
+	return -1
+}
+
+// NextRetry schedules the next attempt of a failed job according to its
+// retry policy. A zero time defers to River's default retry policy.
+func (w *BashWorker) NextRetry(job *river.Job[BashJobArgs]) time.Time {
+	if job.Args.Retry == nil {
+		return time.Time{}
+	}
+	return job.Args.Retry.nextRetryAt(time.Now(), job.Attempt)
+}
+
+// upstreamFailedReason is the reason recorded on a job cancelled because a
+// dependency it needed to succeed did not. qq init's release trigger
+// records the same text.
+func upstreamFailedReason(upstreamID int64) string {
+	return fmt.Sprintf("upstream job %d failed", upstreamID)
+}
+
 // checkDependencies checks if all dependencies for a job are satisfied.
 // Returns (true, nil) if all deps are met, (false, nil) if some are pending,
 // or (false, error) if a dep failed and condition is "succeeded" (returns JobCancel).
-func (w *BashWorker) checkDependencies(ctx context.Context, jobID int64) (bool, error) {
+// In the last case the job's result records which dependency failed.
+func (w *BashWorker) checkDependencies(ctx context.Context, jobID int64, attempt int) (bool, error) {
 	if w.jobTableName == "" {
 		return true, nil
 	}
 
 	rows, err := w.pool.Query(ctx, fmt.Sprintf(`
-		SELECT d.condition, j.state, r.exit_code
+		SELECT d.depends_on_job_id, d.condition, j.state, r.exit_code, r.reason
 		FROM job_dependencies d
 		JOIN %s j ON j.id = d.depends_on_job_id
 		LEFT JOIN job_results r ON r.job_id = j.id AND r.attempt = j.attempt
@@ -51,12 +156,14 @@ func (w *BashWorker) checkDependencies(ctx context.Context, jobID int64) (bool,
 	}
 	defer rows.Close()
 
-	hasDeps := false
+	var failedID int64
+	var failure error
 	for rows.Next() {
-		hasDeps = true
+		var depID int64
 		var condition, state string
 		var exitCode sql.NullInt32
-		if err := rows.Scan(&condition, &state, &exitCode); err != nil {
+		var reason sql.NullString
+		if err := rows.Scan(&depID, &condition, &state, &exitCode, &reason); err != nil {
 			return false, fmt.Errorf("failed to scan dependency: %w", err)
 		}
 
@@ -67,46 +174,161 @@ func (w *BashWorker) checkDependencies(ctx context.Context, jobID int64) (bool,
 			if exitCode.Valid && exitCode.Int32 == 0 {
 				// satisfied
 			} else {
-				return false, river.JobCancel(fmt.Errorf("dependency failed: exit code %d", exitCode.Int32))
+				failedID, failure = depID, fmt.Errorf("dependency failed: exit code %d", exitCode.Int32)
 			}
 		case (state == "discarded" || state == "cancelled") && condition == "finished":
 			// satisfied — terminal state counts for "finished"
 		case state == "discarded" || state == "cancelled":
 			// condition is "succeeded" but dep is in a failed terminal state
-			return false, river.JobCancel(fmt.Errorf("dependency %s", state))
+			if reason.String == ReasonTimeout {
+				failedID, failure = depID, fmt.Errorf("dependency timed out")
+			} else {
+				failedID, failure = depID, fmt.Errorf("dependency %s", state)
+			}
 		default:
 			// dependency not yet in terminal state
 			return false, nil
 		}
+		if failure != nil {
+			break
+		}
 	}
+	rows.Close()
 
-	if !hasDeps {
-		return true, nil
+	if failure != nil {
+		if err := saveJobResult(ctx, w.pool, jobID, attempt, "", ExitCodeCancelled, upstreamFailedReason(failedID)); err != nil {
+			fmt.Println("Failed to save job result:", err)
+		}
+		return false, river.JobCancel(failure)
 	}
+
 	return true, nil
 }
 
 // Work executes the bash command
 func (w *BashWorker) Work(ctx context.Context, job *river.Job[BashJobArgs]) error {
+	queueName := w.router.queueName(job.Queue)
+
+	// Jobs with requirements are fetched from routes that only workers
+	// whose labels satisfy them process
+	if !MatchLabels(job.Args.Requires, w.labels) {
+		return w.reroute(ctx, job, queueName)
+	}
+
+	// River fetches up to MaxWorkers from a queue and from each of its
+	// routes on its own, so a job fetched while every slot of its queue or
+	// of the worker is taken waits for one here, keeping its place ahead of
+	// jobs fetched after it. A job whose context ends while it waits (its
+	// worker stops) never ran, so it goes back to the queue, unless it was
+	// cancelled with "qq job rm".
+	for _, slots := range []chan struct{}{w.queueSlots[queueName], w.slots} {
+		if slots == nil {
+			continue
+		}
+		select {
+		case slots <- struct{}{}:
+			defer func() { <-slots }()
+		case <-ctx.Done():
+			if !errors.Is(context.Cause(ctx), river.ErrJobCancelledRemotely) {
+				return river.JobSnooze(0)
+			}
+			if w.pool != nil {
+				if err := saveJobResult(context.WithoutCancel(ctx), w.pool, job.ID, job.Attempt, "", ExitCodeCancelled, ReasonCancelled); err != nil {
+					fmt.Println("Failed to save job result:", err)
+				}
+			}
+			return river.JobCancel(fmt.Errorf("job cancelled"))
+		}
+	}
+
 	// Check dependencies before executing
-	satisfied, err := w.checkDependencies(ctx, job.ID)
+	satisfied, err := w.checkDependencies(ctx, job.ID, job.Attempt)
 	if err != nil {
 		return err // JobCancel for failed deps
 	}
 	if !satisfied {
+		// Jobs normally only become available once their dependencies
+		// have finished. This covers dependencies recorded after the job
+		// was inserted, and databases that predate the release trigger.
 		return river.JobSnooze(5 * time.Second)
 	}
 
-	// Execute the command
-	cmd := exec.CommandContext(ctx, "bash", "-c", job.Args.Command)
-	output, cmdErr := cmd.CombinedOutput()
+	// Queues with a global limit run at most that many jobs across all
+	// workers; a job over the limit goes back to the queue like above. So
+	// does a job whose slot could not be looked up: it didn't fail itself.
+	if w.jobTableName != "" {
+		held, acquired, err := acquireQueueSlot(ctx, w.pool, w.jobTableName, queueName, job.ID)
+		if err != nil {
+			fmt.Println("Failed to acquire queue slot:", err)
+			return river.JobSnooze(queueSlotRetryInterval)
+		}
+		if !acquired {
+			return river.JobSnooze(queueSlotRetryInterval)
+		}
+		if held {
+			defer func() {
+				if err := releaseQueueSlot(context.WithoutCancel(ctx), w.pool, job.ID); err != nil {
+					fmt.Println("Failed to release queue slot:", err)
+				}
+			}()
+		}
+	}
+
+	if w.jobs != nil {
+		w.jobs.start(job.ID, queueName)
+		defer w.jobs.finish(job.ID)
+	}
+
+	// The job's timeout starts now that it has all of its slots
+	timeout := w.runTimeout(job)
+	runCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// Execute the command in its own process group. When the run context is
+	// done (the job was cancelled by "qq job rm --force", its worker stops or
+	// it is past its timeout) the group gets SIGTERM, and whatever is still
+	// alive after the grace period gets SIGKILL.
+	cmd := exec.CommandContext(runCtx, "bash", "-c", job.Args.Command)
+	cmd.Dir = job.Args.Workdir
+	if len(job.Args.Env) > 0 || len(w.envAllowlist) > 0 {
+		cmd.Env = buildJobEnv(w.envAllowlist, job.Args.Env)
+	}
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error {
+		return terminateProcessGroup(cmd)
+	}
+	cmd.WaitDelay = w.killGracePeriod
+
+	// Stream stdout and stderr separately to job_output_chunks while the
+	// command runs; job_results keeps the merged output.
+	// Chunks are still written after the job context is done so that the
+	// output of a killed command is not lost.
+	stream := newOutputStream(context.WithoutCancel(ctx), w.pool, job.ID, job.Attempt)
+	cmd.Stdout = stream.Stdout()
+	cmd.Stderr = stream.Stderr()
+	startedAt := time.Now()
+	cmdErr := cmd.Run()
+	duration := time.Since(startedAt)
+	if runCtx.Err() != nil {
+		_ = killProcessGroup(cmd)
+	}
+	stream.Close(context.WithoutCancel(ctx))
+	output := sanitizeOutput(stream.String())
+	cancelled := errors.Is(context.Cause(ctx), river.ErrJobCancelledRemotely)
+	interrupted := ctx.Err() != nil && !cancelled
+	timedOut := ctx.Err() == nil && errors.Is(runCtx.Err(), context.DeadlineExceeded)
 
 	// Extract exit code
 	exitCode := 0
+	reason := ""
 	if cmdErr != nil {
 		fmt.Println("Job failed:", job.Args.Command)
 		fmt.Println("Error:", cmdErr)
-		fmt.Println("Output:", string(output))
+		fmt.Println("Output:", output)
 
 		// Try to get the exit code from the error
 		if exitErr, ok := cmdErr.(*exec.ExitError); ok {
@@ -116,36 +338,77 @@ func (w *BashWorker) Work(ctx context.Context, job *river.Job[BashJobArgs]) erro
 		}
 	} else {
 		fmt.Println("Job completed successfully:", job.Args.Command)
-		fmt.Println("Output:", string(output))
+		fmt.Println("Output:", output)
+	}
+
+	switch {
+	case cancelled:
+		fmt.Println("Job cancelled:", job.Args.Command)
+		exitCode = ExitCodeCancelled
+		reason = ReasonCancelled
+		cmdErr = fmt.Errorf("job cancelled")
+	case timedOut:
+		fmt.Printf("Job timed out after %s: %s\n", timeout, job.Args.Command)
+		exitCode = ExitCodeTimeout
+		reason = ReasonTimeout
+		cmdErr = fmt.Errorf("job timed out after %s", timeout)
+	case interrupted:
+		fmt.Println("Job interrupted by worker shutdown:", job.Args.Command)
+		exitCode = ExitCodeCancelled
+		reason = ReasonInterrupted
+	}
+
+	if w.metrics != nil {
+		w.metrics.observe(queueName, duration, exitCode, len(output))
 	}
 
-	// Store the result in the database
+	// Store the result in the database. The job context may already be
+	// cancelled at this point, so the partial output is saved without it.
 	if w.pool != nil {
-		saveErr := w.saveJobResult(ctx, job.ID, job.Attempt, string(output), exitCode)
+		saveErr := saveJobResult(context.WithoutCancel(ctx), w.pool, job.ID, job.Attempt, output, exitCode, reason)
 		if saveErr != nil {
 			fmt.Println("Failed to save job result:", saveErr)
 		}
 	}
 
-	// Cancel the job so River marks it as discarded (failed) immediately
-	// instead of retrying it
+	// The worker is shutting down, so the job goes back to its queue to run
+	// again on the next worker
+	if interrupted {
+		return river.JobSnooze(0)
+	}
+
 	if cmdErr != nil {
-		return river.JobCancel(fmt.Errorf("command failed with exit code %d: %w", exitCode, cmdErr))
+		err := fmt.Errorf("command failed with exit code %d: %w", exitCode, cmdErr)
+
+		// Hand retryable failures back to River, which reschedules them via
+		// NextRetry until max_attempts is used up and then discards them
+		if job.Args.Retry != nil && !cancelled && job.Args.Retry.Retryable(exitCode) {
+			if job.Attempt < job.MaxAttempts {
+				fmt.Printf("Job will be retried (attempt %d of %d)\n", job.Attempt, job.MaxAttempts)
+			}
+			return err
+		}
+
+		// Cancel the job so River marks it as failed immediately instead of
+		// retrying it
+		return river.JobCancel(err)
 	}
 
 	return nil
 }
 
-// saveJobResult stores the command output and exit code in the database
-func (w *BashWorker) saveJobResult(ctx context.Context, jobID int64, attempt int, output string, exitCode int) error {
-	_, err := w.pool.Exec(ctx, `
-		INSERT INTO job_results (job_id, attempt, output, exit_code, created_at)
-		VALUES ($1, $2, $3, $4, NOW())
+// saveJobResult stores the command output, exit code and, when qq ended the
+// job itself, the reason in the database
+func saveJobResult(ctx context.Context, pool *pgxpool.Pool, jobID int64, attempt int, output string, exitCode int, reason string) error {
+	_, err := pool.Exec(ctx, `
+		INSERT INTO job_results (job_id, attempt, output, exit_code, reason, created_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NOW())
 		ON CONFLICT (job_id, attempt) DO UPDATE SET
 			output = $3,
 			exit_code = $4,
+			reason = NULLIF($5, ''),
 			created_at = NOW()
-	`, jobID, attempt, output, exitCode)
+	`, jobID, attempt, output, exitCode, reason)
 
 	return err
 }
@@ -154,9 +417,18 @@ func (w *BashWorker) saveJobResult(ctx context.Context, jobID int64, attempt int
 type QueueStats struct {
 	Name      string
 	Pending   int
+	Blocked   int // waiting for dependencies
 	Running   int
 	Completed int
 	Failed    int
+	Paused    bool // workers don't start new jobs from the queue
+
+	// Settings of queues defined with "qq queue add"
+	Configured  bool
+	MaxWorkers  int
+	Description string
+	GlobalLimit int // running jobs across all workers, 0 for no limit
+	LimitUsed   int // running jobs holding a slot of the global limit
 }
 
 // JobDependency represents a dependency between two jobs
@@ -170,6 +442,28 @@ type JobDependency struct {
 type QueueClient struct {
 	client *river.Client[pgx.Tx]
 	pool   *pgxpool.Pool
+
+	// stopCron stops the cron scheduler of a worker client
+	stopCron context.CancelFunc
+
+	// registration is a worker client's entry in the workers table, which
+	// its heartbeat keeps up to date until stopHeartbeat is called
+	registration  *workerRegistration
+	stopHeartbeat context.CancelFunc
+	heartbeatDone chan struct{}
+
+	// drainRequested is closed when the heartbeat finds the worker was
+	// asked to drain
+	drainRequested chan struct{}
+	drainOnce      sync.Once
+
+	// metrics records the jobs a worker client runs
+	metrics *jobMetrics
+
+	// router adds the routes a worker client processes as jobs are
+	// inserted into them, until stopRoutes is called
+	router     *queueRouter
+	stopRoutes context.CancelFunc
 }
 
 // resolveJobTableName detects which table name River uses for jobs
@@ -188,9 +482,50 @@ func resolveJobTableName(ctx context.Context, pool *pgxpool.Pool) (string, error
 
 // WorkerConfig holds configuration for the River worker client.
 type WorkerConfig struct {
-	Concurrency int      // Max concurrent workers (default 5)
-	ID          string   // Worker ID passed to River's Config.ID (must be unique, max 100 chars)
-	Queues      []string // Queue names to process (default ["default"])
+	Concurrency     int           // Max concurrent workers (default 5)
+	ID              string        // Worker ID passed to River's Config.ID (must be unique, max 100 chars)
+	Queues          []string      // Queue names to process (default ["default"])
+	KillGracePeriod time.Duration // Time between SIGTERM and SIGKILL when a job is killed (default 10s)
+
+	// DefaultTimeout applies to jobs that set no timeout of their own and
+	// whose queue has no entry in QueueTimeouts. Zero means no timeout.
+	DefaultTimeout time.Duration
+	QueueTimeouts  map[string]time.Duration
+
+	// EnvAllowlist limits the worker environment variables that jobs
+	// inherit. Empty means jobs inherit the full environment.
+	EnvAllowlist []string
+
+	// QueueConcurrency overrides Concurrency for individual queues, and
+	// takes precedence over the max workers of queues defined with
+	// "qq queue add". TotalConcurrency caps the jobs running at once across
+	// all queues. Zero means no cap.
+	QueueConcurrency map[string]int
+	TotalConcurrency int
+
+	// Version is the qq version the worker reports in the workers table
+	Version string
+
+	// Labels describe the worker's host, e.g. os=linux or gpu=a100. The
+	// worker only runs jobs whose requirements they satisfy.
+	Labels map[string]string
+}
+
+// queueMaxWorkers returns how many jobs a worker runs at once from a queue:
+// the worker's setting for the queue, else the max workers of the queue's
+// definition, else the worker's concurrency, never more than its total
+// concurrency
+func queueMaxWorkers(name string, concurrency int, queueConcurrency map[string]int, queueConfigs map[string]QueueConfig, totalConcurrency int) int {
+	n := concurrency
+	if c, ok := queueConcurrency[name]; ok && c > 0 {
+		n = c
+	} else if qc, ok := queueConfigs[name]; ok && qc.MaxWorkers > 0 {
+		n = qc.MaxWorkers
+	}
+	if totalConcurrency > 0 && n > totalConcurrency {
+		n = totalConcurrency
+	}
+	return n
 }
 
 // NewQueueClient creates a new client for interacting with River Queue.
@@ -208,17 +543,18 @@ func NewQueueClient(ctx context.Context, db interface{}, cfg *WorkerConfig) (*Qu
 	// Create a River driver with the database pool
 	driver := riverpgxv5.New(pool)
 
-	// Create a new worker service with worker implementations
-	workers := river.NewWorkers()
-	river.AddWorker[BashJobArgs](workers, &BashWorker{
-		pool:         pool,
-		jobTableName: jobTableName,
-	})
-
 	// Apply defaults
 	maxWorkers := 5
 	queues := []string{"default"}
+	killGracePeriod := defaultKillGracePeriod
+	var defaultTimeout time.Duration
+	var queueTimeouts map[string]time.Duration
+	var envAllowlist []string
 	var clientID string
+	var queueConcurrency map[string]int
+	var totalConcurrency int
+	var version string
+	var labels map[string]string
 	if cfg != nil {
 		if cfg.Concurrency > 0 {
 			maxWorkers = cfg.Concurrency
@@ -226,19 +562,74 @@ func NewQueueClient(ctx context.Context, db interface{}, cfg *WorkerConfig) (*Qu
 		if len(cfg.Queues) > 0 {
 			queues = cfg.Queues
 		}
+		if cfg.KillGracePeriod > 0 {
+			killGracePeriod = cfg.KillGracePeriod
+		}
+		defaultTimeout = cfg.DefaultTimeout
+		queueTimeouts = cfg.QueueTimeouts
+		envAllowlist = cfg.EnvAllowlist
 		clientID = cfg.ID
+		queueConcurrency = cfg.QueueConcurrency
+		totalConcurrency = cfg.TotalConcurrency
+		version = cfg.Version
+		labels = cfg.Labels
+	}
+
+	// Queues defined with "qq queue add" set their own concurrency, and a
+	// default timeout for queues the worker configures none for
+	queueConfigs, err := loadQueueConfigs(ctx, pool, queues)
+	if err != nil {
+		fmt.Println("Failed to load queue settings, using the worker's:", err)
+	}
+	if len(queueConfigs) > 0 {
+		timeouts := make(map[string]time.Duration, len(queueTimeouts)+len(queueConfigs))
+		for name, d := range queueTimeouts {
+			timeouts[name] = d
+		}
+		for name, qc := range queueConfigs {
+			if _, ok := timeouts[name]; !ok && qc.DefaultTimeout > 0 {
+				timeouts[name] = qc.DefaultTimeout
+			}
+		}
+		queueTimeouts = timeouts
+	}
+
+	// Create a new worker service with worker implementations
+	bashWorker := &BashWorker{
+		pool:            pool,
+		jobTableName:    jobTableName,
+		killGracePeriod: killGracePeriod,
+		defaultTimeout:  defaultTimeout,
+		queueTimeouts:   queueTimeouts,
+		envAllowlist:    envAllowlist,
+		jobs:            newJobTracker(),
+		labels:          labels,
+		metrics:         newJobMetrics(),
+	}
+	if totalConcurrency > 0 {
+		bashWorker.slots = make(chan struct{}, totalConcurrency)
 	}
+	workers := river.NewWorkers()
+	river.AddWorker[BashJobArgs](workers, bashWorker)
 
-	// Build queue config map — each queue shares the same MaxWorkers setting
 	queueMap := make(map[string]river.QueueConfig, len(queues))
+	bashWorker.queueSlots = make(map[string]chan struct{}, len(queues))
 	for _, q := range queues {
-		queueMap[q] = river.QueueConfig{MaxWorkers: maxWorkers}
+		queueMap[q] = river.QueueConfig{
+			MaxWorkers: queueMaxWorkers(q, maxWorkers, queueConcurrency, queueConfigs, totalConcurrency),
+		}
+		bashWorker.queueSlots[q] = make(chan struct{}, queueMap[q].MaxWorkers)
 	}
+	bashWorker.router = newQueueRouter(queueMap, labels)
 
 	// Create River client with the driver and workers
+	// BashWorker.Timeout decides each job's deadline, and jobs without one
+	// may legitimately run for hours, so River's stuck-job rescuer is pushed
+	// well past its default of one hour.
 	riverConfig := &river.Config{
-		Queues:  queueMap,
-		Workers: workers,
+		Queues:               queueMap,
+		Workers:              workers,
+		RescueStuckJobsAfter: 24 * time.Hour,
 	}
 	if clientID != "" {
 		riverConfig.ID = clientID
@@ -249,15 +640,53 @@ func NewQueueClient(ctx context.Context, db interface{}, cfg *WorkerConfig) (*Qu
 		return nil, fmt.Errorf("failed to create river client: %w", err)
 	}
 
+	// Register the worker before it starts taking jobs, so that running
+	// jobs always have a worker entry
+	registration := newWorkerRegistration(client.ID(), version, labels, queueMap, bashWorker.jobs)
+	if _, err := registration.save(ctx, pool, true); err != nil {
+		return nil, fmt.Errorf("failed to register worker (run `qq init` to create the workers table): %w", err)
+	}
+
+	// Process the routes of jobs with requirements the worker's labels
+	// satisfy; the route listener picks up routes added later
+	if err := bashWorker.router.discover(ctx, pool, client); err != nil {
+		return nil, fmt.Errorf("%w (run `qq init` to create the queue_routes table)", err)
+	}
+
 	// Start River client
 	if err := client.Start(ctx); err != nil {
 		return nil, fmt.Errorf("failed to start river client: %w", err)
 	}
 
-	return &QueueClient{
-		client: client,
-		pool:   pool,
-	}, nil
+	q := &QueueClient{
+		client:         client,
+		pool:           pool,
+		registration:   registration,
+		router:         bashWorker.router,
+		metrics:        bashWorker.metrics,
+		heartbeatDone:  make(chan struct{}),
+		drainRequested: make(chan struct{}),
+	}
+
+	heartbeatCtx, stopHeartbeat := context.WithCancel(context.Background())
+	q.stopHeartbeat = stopHeartbeat
+	go func() {
+		defer close(q.heartbeatDone)
+		q.runHeartbeat(heartbeatCtx)
+	}()
+
+	// Add routes created after the worker started as jobs are inserted
+	// into them
+	routesCtx, stopRoutes := context.WithCancel(context.Background())
+	q.stopRoutes = stopRoutes
+	go q.runRouteListener(routesCtx)
+
+	// Workers also fire cron schedules
+	cronCtx, stopCron := context.WithCancel(context.Background())
+	q.stopCron = stopCron
+	go q.runCronScheduler(cronCtx)
+
+	return q, nil
 }
 
 // NewInsertOnlyClient creates a client that can insert jobs but does not start workers.
@@ -296,39 +725,147 @@ func resolvePool(db interface{}) (*pgxpool.Pool, error) {
 	}
 }
 
+// JobOptions holds the optional settings for a job added with
+// AddJobWithOptions
+type JobOptions struct {
+	Queue       string
+	Priority    int // Zero uses the queue's default priority, else 1
+	ScheduledAt *time.Time
+	Timeout     time.Duration     // Zero falls back to the worker's queue default
+	Retry       *RetryPolicy      // Nil means failed jobs are not retried
+	Env         map[string]string // Added to the environment inherited from the worker
+	Workdir     string            // Directory to run in (default: the worker's)
+	UniqueKey   string            // Skip the insert while a job with this key hasn't finished
+	Requires    []string          // Requirements on the labels of the worker that runs the job
+}
+
+// AddJobResult is the job added by AddJobWithOptions
+type AddJobResult struct {
+	JobID     string
+	Priority  int
+	Duplicate bool // an unfinished job with the same unique key exists; JobID is that job's
+}
+
+// uniqueJobOpts makes jobs unique by their UniqueKey among the jobs that
+// have not finished yet, so the key can be reused once a job has completed
+// or was cancelled
+var uniqueJobOpts = river.UniqueOpts{
+	ByArgs: true,
+	ByState: []rivertype.JobState{
+		rivertype.JobStateAvailable,
+		rivertype.JobStatePending,
+		rivertype.JobStateRetryable,
+		rivertype.JobStateRunning,
+		rivertype.JobStateScheduled,
+	},
+}
+
 // AddJob adds a new job to the queue
 func (q *QueueClient) AddJob(ctx context.Context, cmd string, queueName string, priority int, scheduledTime *time.Time) (string, error) {
+	result, err := q.AddJobWithOptions(ctx, cmd, &JobOptions{
+		Queue:       queueName,
+		Priority:    priority,
+		ScheduledAt: scheduledTime,
+	})
+	if err != nil {
+		return "", err
+	}
+	return result.JobID, nil
+}
+
+// AddJobWithOptions adds a new job to the queue using the given options
+func (q *QueueClient) AddJobWithOptions(ctx context.Context, cmd string, jobOpts *JobOptions) (*AddJobResult, error) {
+	if jobOpts == nil {
+		jobOpts = &JobOptions{}
+	}
+
 	// Create job args
 	jobArgs := BashJobArgs{
-		Command: cmd,
+		Command:        cmd,
+		Env:            jobOpts.Env,
+		Workdir:        jobOpts.Workdir,
+		TimeoutSeconds: timeoutSeconds(jobOpts.Timeout),
+		Retry:          jobOpts.Retry,
+		UniqueKey:      jobOpts.UniqueKey,
+		Requires:       jobOpts.Requires,
+	}
+	if err := validateEnvKeys(jobArgs.Env); err != nil {
+		return nil, &ValidationError{Err: err}
+	}
+	if err := ValidateRequirements(jobArgs.Requires); err != nil {
+		return nil, &ValidationError{Err: err}
 	}
 
 	// Create insert options
 	opts := &river.InsertOpts{}
 
-	// Add queue name if specified
-	if queueName != "" && queueName != "default" {
-		opts.Queue = queueName
+	// Failed jobs are cancelled unless they carry a retry policy, so River's
+	// max_attempts only matters for jobs that have one
+	if jobOpts.Retry != nil {
+		if err := jobOpts.Retry.Validate(); err != nil {
+			return nil, &ValidationError{Err: fmt.Errorf("invalid retry policy: %w", err)}
+		}
+		opts.MaxAttempts = jobOpts.Retry.MaxAttempts
 	}
 
-	// Add priority if specified
-	if priority > 0 {
-		opts.Priority = priority
+	queueName := jobOpts.Queue
+	if queueName == "" {
+		queueName = "default"
+	}
+
+	// Add priority if specified, else use the queue's default if it has one
+	opts.Priority = jobOpts.Priority
+	if opts.Priority == 0 {
+		queueConfigs, err := loadQueueConfigs(ctx, q.pool, []string{queueName})
+		if err != nil {
+			return nil, err
+		}
+		opts.Priority = resolvePriority(0, queueName, queueConfigs)
 	}
 
 	// Add scheduled time if specified
-	if scheduledTime != nil {
-		opts.ScheduledAt = *scheduledTime
+	if jobOpts.ScheduledAt != nil {
+		opts.ScheduledAt = *jobOpts.ScheduledAt
+	}
+
+	if jobOpts.UniqueKey != "" {
+		opts.UniqueOpts = uniqueJobOpts
+	}
+
+	// Insert the job into River Queue. A job with requirements goes into
+	// its queue's route for them, which is recorded along with it.
+	tx, err := q.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback(ctx)
 
-	// Insert the job into River Queue
-	result, err := q.client.Insert(ctx, jobArgs, opts)
+	if opts.Queue, err = routeQueueTx(ctx, q.pool, tx, queueName, jobArgs.Requires); err != nil {
+		return nil, err
+	}
+	result, err := q.client.InsertTx(ctx, tx, jobArgs, opts)
 	if err != nil {
-		return "", fmt.Errorf("failed to insert job: %w", err)
+		return nil, fmt.Errorf("failed to insert job: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
 	// Convert job ID to string
-	return fmt.Sprintf("%d", result.Job.ID), nil
+	return &AddJobResult{
+		JobID:     fmt.Sprintf("%d", result.Job.ID),
+		Priority:  result.Job.Priority,
+		Duplicate: result.UniqueSkippedAsDuplicate,
+	}, nil
+}
+
+// timeoutSeconds converts a timeout to the whole seconds stored in job args,
+// rounding up so that sub-second timeouts are not silently dropped
+func timeoutSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int((d + time.Second - 1) / time.Second)
 }
 
 // AddDependency records a dependency between two jobs
@@ -378,9 +915,141 @@ func (q *QueueClient) GetDependencies(ctx context.Context, jobID int64) ([]JobDe
 	return deps, nil
 }
 
-// RemoveJob cancels a job if it hasn't started yet
-func (q *QueueClient) RemoveJob(ctx context.Context, jobID string) error {
-	return fmt.Errorf("job cancellation not implemented in this version")
+// Errors returned for jobs that don't exist or are in the wrong state for
+// what was asked, e.g. cancelling a finished job
+var (
+	ErrJobNotFound    = errors.New("not found")
+	ErrJobFinished    = errors.New("has already finished")
+	ErrJobRunning     = errors.New("is running")
+	ErrJobNotFinished = errors.New("has not finished")
+)
+
+// RemoveJob cancels a job. Pending and scheduled jobs are cancelled right
+// away. Running jobs are only cancelled when force is set: River notifies the
+// worker holding the job, which terminates the command's process group and
+// records the partial output.
+func (q *QueueClient) RemoveJob(ctx context.Context, jobID string, force bool) error {
+	id, err := strconv.ParseInt(jobID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid job ID %q: %w", jobID, err)
+	}
+
+	// Without force, a job that starts running while it is being cancelled
+	// must be left alone, so it is only cancelled while it is still waiting
+	if !force {
+		attempt, cancelled, err := q.cancelWaitingJob(ctx, id)
+		if err != nil {
+			return err
+		}
+		if cancelled {
+			if err := q.recordCancellation(ctx, id, attempt); err != nil {
+				return fmt.Errorf("failed to record cancellation: %w", err)
+			}
+			return nil
+		}
+	}
+
+	job, err := q.client.JobGet(ctx, id)
+	if err != nil {
+		if errors.Is(err, river.ErrNotFound) {
+			return fmt.Errorf("job %d %w", id, ErrJobNotFound)
+		}
+		return fmt.Errorf("failed to get job: %w", err)
+	}
+
+	switch job.State {
+	case rivertype.JobStateCompleted, rivertype.JobStateCancelled, rivertype.JobStateDiscarded:
+		return fmt.Errorf("job %d %w (state: %s)", id, ErrJobFinished, job.State)
+	case rivertype.JobStateRunning:
+		if !force {
+			return fmt.Errorf("job %d %w, use --force to kill it", id, ErrJobRunning)
+		}
+	}
+	if !force {
+		// The job went back to waiting after the attempt to cancel it,
+		// e.g. a running job that was snoozed
+		return fmt.Errorf("job %d changed state while being cancelled (state: %s), try again", id, job.State)
+	}
+
+	cancelled, err := q.client.JobCancel(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to cancel job: %w", err)
+	}
+
+	// A running job records its own result once the worker has killed it.
+	// Anything else never got to run this attempt, so record it here.
+	if cancelled.State == rivertype.JobStateCancelled {
+		if err := q.recordCancellation(ctx, cancelled.ID, cancelled.Attempt); err != nil {
+			return fmt.Errorf("failed to record cancellation: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// cancelWaitingJob cancels a job only if it has not started running, in a
+// single statement so that a worker can't claim it in between. It sets the
+// same metadata as River's JobCancel. It returns the job's attempt and
+// whether it was cancelled.
+func (q *QueueClient) cancelWaitingJob(ctx context.Context, jobID int64) (int, bool, error) {
+	jobTableName, err := resolveJobTableName(ctx, q.pool)
+	if err != nil {
+		return 0, false, err
+	}
+
+	var attempt int
+	err = q.pool.QueryRow(ctx, fmt.Sprintf(`
+		UPDATE %s
+		SET state = 'cancelled',
+			finalized_at = NOW(),
+			metadata = jsonb_set(metadata, '{cancel_attempted_at}', to_jsonb(NOW()))
+		WHERE id = $1 AND state IN ('available', 'scheduled', 'pending', 'retryable')
+		RETURNING attempt
+	`, jobTableName), jobID).Scan(&attempt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to cancel job: %w", err)
+	}
+	return attempt, true, nil
+}
+
+// recordCancellation stores a cancelled result for a job that was not
+// running. Output from an earlier attempt with the same number is kept.
+func (q *QueueClient) recordCancellation(ctx context.Context, jobID int64, attempt int) error {
+	_, err := q.pool.Exec(ctx, `
+		INSERT INTO job_results (job_id, attempt, output, exit_code, reason, created_at)
+		VALUES ($1, $2, '', $3, $4, NOW())
+		ON CONFLICT (job_id, attempt) DO UPDATE SET
+			reason = $4
+	`, jobID, attempt, ExitCodeCancelled, ReasonCancelled)
+	return err
+}
+
+// RetryJob runs a finished job again right away, as its next attempt. The
+// job keeps its ID, and the results of its earlier attempts are kept. Jobs
+// that were cancelled because this job failed are not retried with it; use
+// RetryPipelineRun for pipelines.
+func (q *QueueClient) RetryJob(ctx context.Context, jobID int64) error {
+	job, err := q.client.JobGet(ctx, jobID)
+	if err != nil {
+		if errors.Is(err, river.ErrNotFound) {
+			return fmt.Errorf("job %d %w", jobID, ErrJobNotFound)
+		}
+		return fmt.Errorf("failed to get job: %w", err)
+	}
+
+	switch job.State {
+	case rivertype.JobStateCompleted, rivertype.JobStateCancelled, rivertype.JobStateDiscarded:
+	default:
+		return fmt.Errorf("job %d %w (state: %s)", jobID, ErrJobNotFinished, job.State)
+	}
+
+	if _, err := q.client.JobRetry(ctx, jobID); err != nil {
+		return fmt.Errorf("failed to retry job: %w", err)
+	}
+	return nil
 }
 
 // JobInfo represents job information retrieved from the database
@@ -393,7 +1062,13 @@ type JobInfo struct {
 	ScheduledAt time.Time
 	Output      string
 	ExitCode    int
+	Reason      string
 	Attempt     int
+	Requires    []string // requirements on the labels of the worker that runs it
+
+	// Unroutable is set on a waiting job with requirements that no live
+	// worker processing its queue satisfies
+	Unroutable bool
 }
 
 // ListJobs retrieves jobs from the database
@@ -408,18 +1083,22 @@ func (q *QueueClient) ListJobs(ctx context.Context, queueName string, status str
 	queryBuilder.WriteString(fmt.Sprintf(`
 		SELECT
 			j.id,
-			j.queue,
+			COALESCE(rt.queue, j.queue),
 			j.state,
 			j.args->>'command' as command,
 			j.created_at,
 			j.scheduled_at,
 			j.attempt,
 			r.output,
-			r.exit_code
+			r.exit_code,
+			r.reason,
+			COALESCE(j.args->'requires', '[]'::jsonb)
 		FROM
 			%s j
 		LEFT JOIN
 			job_results r ON j.id = r.job_id AND j.attempt = r.attempt
+		LEFT JOIN
+			queue_routes rt ON rt.name = j.queue
 		WHERE 1=1
 	`, jobTableName))
 
@@ -428,7 +1107,7 @@ func (q *QueueClient) ListJobs(ctx context.Context, queueName string, status str
 	argPos := 1
 
 	if queueName != "" {
-		queryBuilder.WriteString(fmt.Sprintf(" AND j.queue = $%d", argPos))
+		queryBuilder.WriteString(fmt.Sprintf(" AND (j.queue = $%[1]d OR j.queue IN (SELECT name FROM queue_routes WHERE queue = $%[1]d))", argPos))
 		args = append(args, queueName)
 		argPos++
 	}
@@ -438,6 +1117,8 @@ func (q *QueueClient) ListJobs(ctx context.Context, queueName string, status str
 		switch status {
 		case "pending":
 			queryBuilder.WriteString(fmt.Sprintf(" AND j.state IN ('available', 'scheduled')"))
+		case "blocked":
+			queryBuilder.WriteString(fmt.Sprintf(" AND j.state = 'pending'"))
 		case "running":
 			queryBuilder.WriteString(fmt.Sprintf(" AND j.state = 'running'"))
 		case "completed":
@@ -467,6 +1148,7 @@ func (q *QueueClient) ListJobs(ctx context.Context, queueName string, status str
 		var command sql.NullString
 		var output sql.NullString
 		var exitCode sql.NullInt32
+		var reason sql.NullString
 		var attempt sql.NullInt32
 
 		if err := rows.Scan(
@@ -479,6 +1161,8 @@ func (q *QueueClient) ListJobs(ctx context.Context, queueName string, status str
 			&attempt,
 			&output,
 			&exitCode,
+			&reason,
+			&job.Requires,
 		); err != nil {
 			return nil, fmt.Errorf("failed to scan job row: %w", err)
 		}
@@ -501,13 +1185,21 @@ func (q *QueueClient) ListJobs(ctx context.Context, queueName string, status str
 			job.ExitCode = int(exitCode.Int32)
 		}
 
+		if reason.Valid {
+			job.Reason = reason.String
+		}
+
 		jobs = append(jobs, job)
 	}
 
+	if err := q.markUnroutable(ctx, jobs); err != nil {
+		return nil, err
+	}
 	return jobs, nil
 }
 
-// GetJob retrieves a single job by ID
+// GetJob retrieves a single job by ID. For a job that is still running, the
+// output streamed so far is returned.
 func (q *QueueClient) GetJob(ctx context.Context, jobID int64) (*JobInfo, error) {
 	jobTableName, err := resolveJobTableName(ctx, q.pool)
 	if err != nil {
@@ -518,23 +1210,32 @@ func (q *QueueClient) GetJob(ctx context.Context, jobID int64) (*JobInfo, error)
 	var command sql.NullString
 	var output sql.NullString
 	var exitCode sql.NullInt32
+	var reason sql.NullString
 	var attempt sql.NullInt32
 
 	err = q.pool.QueryRow(ctx, fmt.Sprintf(`
 		SELECT
 			j.id,
-			j.queue,
+			COALESCE(rt.queue, j.queue),
 			j.state,
 			j.args->>'command' as command,
 			j.created_at,
 			j.scheduled_at,
 			j.attempt,
-			r.output,
-			r.exit_code
+			COALESCE(r.output, (
+				SELECT string_agg(c.data, '' ORDER BY c.seq)
+				FROM job_output_chunks c
+				WHERE c.job_id = j.id AND c.attempt = j.attempt
+			)) AS output,
+			r.exit_code,
+			r.reason,
+			COALESCE(j.args->'requires', '[]'::jsonb)
 		FROM
 			%s j
 		LEFT JOIN
 			job_results r ON j.id = r.job_id AND j.attempt = r.attempt
+		LEFT JOIN
+			queue_routes rt ON rt.name = j.queue
 		WHERE
 			j.id = $1
 	`, jobTableName), jobID).Scan(
@@ -547,7 +1248,12 @@ func (q *QueueClient) GetJob(ctx context.Context, jobID int64) (*JobInfo, error)
 		&attempt,
 		&output,
 		&exitCode,
+		&reason,
+		&job.Requires,
 	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("job %d %w", jobID, ErrJobNotFound)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get job: %w", err)
 	}
@@ -564,8 +1270,15 @@ func (q *QueueClient) GetJob(ctx context.Context, jobID int64) (*JobInfo, error)
 	if exitCode.Valid {
 		job.ExitCode = int(exitCode.Int32)
 	}
+	if reason.Valid {
+		job.Reason = reason.String
+	}
 
-	return &job, nil
+	jobs := []JobInfo{job}
+	if err := q.markUnroutable(ctx, jobs); err != nil {
+		return nil, err
+	}
+	return &jobs[0], nil
 }
 
 // GetJobOutput retrieves the full output for a specific job
@@ -609,6 +1322,46 @@ func (q *QueueClient) GetJobOutput(ctx context.Context, jobID int64) (string, in
 	return outputStr, exitCodeInt, nil
 }
 
+// JobAttempt represents the recorded result of one attempt of a job
+type JobAttempt struct {
+	Attempt   int
+	Output    string
+	ExitCode  int
+	Reason    string
+	CreatedAt time.Time
+}
+
+// GetJobAttempts retrieves the results of every recorded attempt of a job,
+// oldest first
+func (q *QueueClient) GetJobAttempts(ctx context.Context, jobID int64) ([]JobAttempt, error) {
+	rows, err := q.pool.Query(ctx, `
+		SELECT attempt, output, exit_code, reason, created_at
+		FROM job_results
+		WHERE job_id = $1
+		ORDER BY attempt
+	`, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query job attempts: %w", err)
+	}
+	defer rows.Close()
+
+	var attempts []JobAttempt
+	for rows.Next() {
+		var a JobAttempt
+		var output sql.NullString
+		var exitCode sql.NullInt32
+		var reason sql.NullString
+		if err := rows.Scan(&a.Attempt, &output, &exitCode, &reason, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan job attempt: %w", err)
+		}
+		a.Output = output.String
+		a.ExitCode = int(exitCode.Int32)
+		a.Reason = reason.String
+		attempts = append(attempts, a)
+	}
+	return attempts, rows.Err()
+}
+
 // GetQueueStats retrieves statistics for all queues or a specific queue
 func (q *QueueClient) GetQueueStats(ctx context.Context, queueName string) ([]QueueStats, error) {
 	jobTableName, err := resolveJobTableName(ctx, q.pool)
@@ -616,25 +1369,64 @@ func (q *QueueClient) GetQueueStats(ctx context.Context, queueName string) ([]Qu
 		return nil, err
 	}
 
-	// Build query
-	query := fmt.Sprintf(`
-		SELECT
-			queue,
-			SUM(CASE WHEN state IN ('available', 'scheduled') THEN 1 ELSE 0 END) as pending,
-			SUM(CASE WHEN state = 'running' THEN 1 ELSE 0 END) as running,
-			SUM(CASE WHEN state = 'completed' THEN 1 ELSE 0 END) as completed,
-			SUM(CASE WHEN state IN ('discarded', 'cancelled', 'retryable') THEN 1 ELSE 0 END) as failed
-		FROM
-			%s
-	`, jobTableName)
-
+	// Build query. Queues defined with "qq queue add" and queues River
+	// knows about from workers are listed even when they have no jobs, so
+	// that configured and paused queues always show up. Jobs in a route
+	// count towards its queue, and routes are not listed themselves.
+	jobFilter, queueFilter := "", ""
 	args := []interface{}{}
 	if queueName != "" {
-		query += " WHERE queue = $1"
+		jobFilter, queueFilter = "WHERE j.queue = $1 OR j.queue IN (SELECT name FROM queue_routes WHERE queue = $1)", "WHERE n.name = $1"
 		args = append(args, queueName)
 	}
-
-	query += " GROUP BY queue"
+	query := fmt.Sprintf(`
+		WITH stats AS (
+			SELECT
+				COALESCE(rt.queue, j.queue) AS queue,
+				SUM(CASE WHEN j.state IN ('available', 'scheduled') THEN 1 ELSE 0 END) as pending,
+				SUM(CASE WHEN j.state = 'pending' THEN 1 ELSE 0 END) as blocked,
+				SUM(CASE WHEN j.state = 'running' THEN 1 ELSE 0 END) as running,
+				SUM(CASE WHEN j.state = 'completed' THEN 1 ELSE 0 END) as completed,
+				SUM(CASE WHEN j.state IN ('discarded', 'cancelled', 'retryable') THEN 1 ELSE 0 END) as failed
+			FROM
+				%[1]s j
+			LEFT JOIN
+				queue_routes rt ON rt.name = j.queue
+			%[2]s
+			GROUP BY 1
+		),
+		names AS (
+			SELECT queue AS name FROM stats
+			UNION SELECT name FROM river_queue WHERE name NOT IN (SELECT name FROM queue_routes)
+			UNION SELECT name FROM queue_configs
+		),
+		slots AS (
+			SELECT s.queue, COUNT(*) AS used
+			FROM queue_slots s
+			JOIN %[1]s j ON j.id = s.job_id AND j.state = 'running'
+			GROUP BY s.queue
+		)
+		SELECT
+			n.name,
+			COALESCE(s.pending, 0),
+			COALESCE(s.blocked, 0),
+			COALESCE(s.running, 0),
+			COALESCE(s.completed, 0),
+			COALESCE(s.failed, 0),
+			rq.paused_at IS NOT NULL,
+			qc.name IS NOT NULL,
+			COALESCE(qc.max_workers, 0),
+			COALESCE(qc.description, ''),
+			COALESCE(qc.global_limit, 0),
+			COALESCE(sl.used, 0)
+		FROM names n
+		LEFT JOIN stats s ON s.queue = n.name
+		LEFT JOIN river_queue rq ON rq.name = n.name
+		LEFT JOIN queue_configs qc ON qc.name = n.name
+		LEFT JOIN slots sl ON sl.queue = n.name
+		%[3]s
+		ORDER BY n.name
+	`, jobTableName, jobFilter, queueFilter)
 
 	// Execute query
 	rows, err := q.pool.Query(ctx, query, args...)
@@ -647,7 +1439,8 @@ func (q *QueueClient) GetQueueStats(ctx context.Context, queueName string) ([]Qu
 	var stats []QueueStats
 	for rows.Next() {
 		var stat QueueStats
-		if err := rows.Scan(&stat.Name, &stat.Pending, &stat.Running, &stat.Completed, &stat.Failed); err != nil {
+		if err := rows.Scan(&stat.Name, &stat.Pending, &stat.Blocked, &stat.Running, &stat.Completed, &stat.Failed, &stat.Paused,
+			&stat.Configured, &stat.MaxWorkers, &stat.Description, &stat.GlobalLimit, &stat.LimitUsed); err != nil {
 			return nil, fmt.Errorf("failed to scan queue stats: %w", err)
 		}
 		stats = append(stats, stat)
@@ -656,89 +1449,62 @@ func (q *QueueClient) GetQueueStats(ctx context.Context, queueName string) ([]Qu
 	return stats, nil
 }
 
-// WorkerInfo represents an active queue with worker activity.
-// River tracks worker presence via the river_queue table, so each entry
-// corresponds to a queue that has had recent worker activity.
-type WorkerInfo struct {
-	ID        string
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	Queues    []WorkerQueueInfo
-}
-
-// WorkerQueueInfo represents a queue that a worker is watching
-type WorkerQueueInfo struct {
-	Name             string
-	MaxWorkers       int
-	NumJobsRunning   int
-	NumJobsCompleted int
+// PauseQueue pauses a queue through River: workers finish the jobs they are
+// running but start no new ones from the queue until it is resumed. Queues
+// are known to River once a worker has processed them. The queue's routes
+// are paused with it; routes no worker has processed yet start paused.
+func (q *QueueClient) PauseQueue(ctx context.Context, name string) error {
+	if err := q.client.QueuePause(ctx, name, nil); err != nil {
+		if errors.Is(err, rivertype.ErrNotFound) {
+			return fmt.Errorf("queue %q not found (no worker has processed it yet)", name)
+		}
+		return fmt.Errorf("failed to pause queue: %w", err)
+	}
+	routes, err := queueRoutes(ctx, q.pool, name)
+	if err != nil {
+		return err
+	}
+	for _, route := range routes {
+		if err := q.client.QueuePause(ctx, route, nil); err != nil && !errors.Is(err, rivertype.ErrNotFound) {
+			return fmt.Errorf("failed to pause queue route %s: %w", route, err)
+		}
+	}
+	return nil
 }
 
-// ListWorkers retrieves active workers by querying River's river_queue table.
-// River producers periodically update river_queue.updated_at as a heartbeat
-// (default interval is 10 minutes). We also count running jobs per queue from
-// the river_job table to show current activity.
-func (q *QueueClient) ListWorkers(ctx context.Context) ([]WorkerInfo, error) {
-	// Resolve the job table name (river_job or schema-prefixed variant)
-	jobTableName, _ := resolveJobTableName(ctx, q.pool)
-	if jobTableName == "" {
-		jobTableName = "river_job"
+// ResumeQueue resumes a paused queue and its routes
+func (q *QueueClient) ResumeQueue(ctx context.Context, name string) error {
+	if err := q.client.QueueResume(ctx, name, nil); err != nil {
+		if errors.Is(err, rivertype.ErrNotFound) {
+			return fmt.Errorf("queue %q not found (no worker has processed it yet)", name)
+		}
+		return fmt.Errorf("failed to resume queue: %w", err)
 	}
-
-	// Query active queues from river_queue. A queue is considered active if
-	// updated within the last 11 minutes (River's default report interval is 10m).
-	query := fmt.Sprintf(`
-		SELECT
-			rq.name,
-			rq.created_at,
-			rq.updated_at,
-			COALESCE(running.cnt, 0) AS num_jobs_running
-		FROM river_queue rq
-		LEFT JOIN (
-			SELECT queue, COUNT(*) AS cnt
-			FROM %s
-			WHERE state = 'running'
-			GROUP BY queue
-		) running ON running.queue = rq.name
-		WHERE rq.updated_at > NOW() - INTERVAL '11 minutes'
-		ORDER BY rq.name
-	`, jobTableName)
-
-	rows, err := q.pool.Query(ctx, query)
+	routes, err := queueRoutes(ctx, q.pool, name)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query workers: %w", err)
+		return err
 	}
-	defer rows.Close()
-
-	var workers []WorkerInfo
-	for rows.Next() {
-		var name string
-		var createdAt, updatedAt time.Time
-		var numRunning int
-
-		if err := rows.Scan(&name, &createdAt, &updatedAt, &numRunning); err != nil {
-			return nil, fmt.Errorf("failed to scan worker row: %w", err)
+	for _, route := range routes {
+		if err := q.client.QueueResume(ctx, route, nil); err != nil && !errors.Is(err, rivertype.ErrNotFound) {
+			return fmt.Errorf("failed to resume queue route %s: %w", route, err)
 		}
-
-		workers = append(workers, WorkerInfo{
-			ID:        name,
-			CreatedAt: createdAt,
-			UpdatedAt: updatedAt,
-			Queues: []WorkerQueueInfo{
-				{
-					Name:           name,
-					NumJobsRunning: numRunning,
-				},
-			},
-		})
 	}
-
-	return workers, nil
+	// Workers don't add the routes of a paused queue until it is resumed
+	return notifyRoutes(ctx, q.pool, routes)
 }
 
-// Close stops the River client
+// Close stops the cron scheduler and the River client. A worker then
+// stops heartbeating and removes its entry from the workers table.
 func (q *QueueClient) Close(ctx context.Context) error {
-	return q.client.Stop(ctx)
+	if q.stopCron != nil {
+		q.stopCron()
+	}
+	if q.stopRoutes != nil {
+		q.stopRoutes()
+	}
+	err := q.client.Stop(ctx)
+	q.deregister(ctx)
+	return err
 }
 
 // Pool returns the underlying database pool for transaction use
@@ -2,10 +2,13 @@ package queue
 
 import (
 	"context"
-	"os/exec"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	
@@ -17,21 +20,10 @@ func TestQueueIntegration(t *testing.T) {
 		t.Skip("Skipping integration test in short mode")
 	}
 
-	// Setup a PostgreSQL database for testing
-	dbURL, cleanup := testutils.SetupTestDatabase(t)
+	// Setup a PostgreSQL database with the qq schema for testing
+	pool, cleanup := testutils.SetupInitializedDatabase(t)
 	defer cleanup()
-
-	// Initialize database schema
-	initCmd := exec.Command("go", "run", ".", "init", "--db-url", dbURL)
-	initCmd.Dir = "../.." // Run from project root
-	output, err := initCmd.CombinedOutput()
-	require.NoError(t, err, "Failed to initialize database: %s", output)
-
-	// Connect to the database
 	ctx := context.Background()
-	pool, err := pgxpool.New(ctx, dbURL)
-	require.NoError(t, err)
-	defer pool.Close()
 
 	// Initialize queue client
 	q, err := NewQueueClient(ctx, pool, nil)
@@ -47,4 +39,106 @@ func TestQueueIntegration(t *testing.T) {
 	jobs, err := q.ListJobs(ctx, "default", "", 10)
 	require.NoError(t, err)
 	assert.GreaterOrEqual(t, len(jobs), 1)
-}
\ No newline at end of file
+}
+
+func TestInterruptedJobRerunOutput(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	pool, cleanup := testutils.SetupInitializedDatabase(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	q, err := NewQueueClient(ctx, pool, nil)
+	require.NoError(t, err)
+	defer q.Close(ctx)
+
+	id, err := q.AddJob(ctx, "echo rerun", "default", 1, nil)
+	require.NoError(t, err)
+	jobID, err := strconv.ParseInt(id, 10, 64)
+	require.NoError(t, err)
+
+	// The first run streams some output, then the worker shuts down
+	w := &BashWorker{pool: pool}
+	runCtx, cancel := context.WithCancel(ctx)
+	time.AfterFunc(2*outputFlushInterval+time.Second, cancel)
+	err = w.Work(runCtx, &river.Job[BashJobArgs]{
+		JobRow: &rivertype.JobRow{ID: jobID, Attempt: 1, Queue: "default"},
+		Args:   BashJobArgs{Command: "echo interrupted; sleep 30"},
+	})
+	var snooze *rivertype.JobSnoozeError
+	require.ErrorAs(t, err, &snooze)
+	chunks, err := q.GetOutputChunks(ctx, jobID, 1, 0)
+	require.NoError(t, err)
+	require.NotEmpty(t, chunks)
+
+	// River runs a snoozed job again as the same attempt
+	err = w.Work(ctx, &river.Job[BashJobArgs]{
+		JobRow: &rivertype.JobRow{ID: jobID, Attempt: 1, Queue: "default"},
+		Args:   BashJobArgs{Command: "echo rerun"},
+	})
+	require.NoError(t, err)
+
+	chunks, err = q.GetOutputChunks(ctx, jobID, 1, 0)
+	require.NoError(t, err)
+	var streamed strings.Builder
+	for _, c := range chunks {
+		streamed.WriteString(c.Data)
+	}
+	assert.Equal(t, "rerun\n", streamed.String())
+
+	var saved string
+	require.NoError(t, pool.QueryRow(ctx, `SELECT output FROM job_results WHERE job_id = $1 AND attempt = 1`, jobID).Scan(&saved))
+	assert.Equal(t, "rerun\n", saved)
+}
+
+func TestRequirementsRouting(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	pool, cleanup := testutils.SetupInitializedDatabase(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	q, err := NewInsertOnlyClient(ctx, pool)
+	require.NoError(t, err)
+
+	result, err := q.AddJobWithOptions(ctx, "nvidia-smi", &JobOptions{Queue: "builds", Requires: []string{"gpu"}})
+	require.NoError(t, err)
+	jobID, err := strconv.ParseInt(result.JobID, 10, 64)
+	require.NoError(t, err)
+
+	// The job waits in the route, but is reported in its queue
+	route := routedQueueName("builds", []string{"gpu"})
+	jobTableName, err := resolveJobTableName(ctx, pool)
+	require.NoError(t, err)
+	var riverQueue string
+	require.NoError(t, pool.QueryRow(ctx, "SELECT queue FROM "+jobTableName+" WHERE id = $1", jobID).Scan(&riverQueue))
+	assert.Equal(t, route, riverQueue)
+
+	job, err := q.GetJob(ctx, jobID)
+	require.NoError(t, err)
+	assert.Equal(t, "builds", job.Queue)
+	jobs, err := q.ListJobs(ctx, "builds", "", 10)
+	require.NoError(t, err)
+	assert.Len(t, jobs, 1)
+
+	// Only workers whose labels satisfy the requirements fetch from the route
+	cpu, err := NewQueueClient(ctx, pool, &WorkerConfig{ID: "cpu", Queues: []string{"builds"}})
+	require.NoError(t, err)
+	defer cpu.Close(ctx)
+	assert.Equal(t, route, cpu.router.queueName(route))
+
+	gpu, err := NewQueueClient(ctx, pool, &WorkerConfig{ID: "gpu", Queues: []string{"builds"}, Labels: map[string]string{"gpu": "a100"}})
+	require.NoError(t, err)
+	defer gpu.Close(ctx)
+	assert.Equal(t, "builds", gpu.router.queueName(route))
+
+	// Routes added later are picked up as jobs are inserted into them
+	_, err = q.AddJobWithOptions(ctx, "nvidia-smi", &JobOptions{Queue: "builds", Requires: []string{"gpu=a100"}})
+	require.NoError(t, err)
+	later := routedQueueName("builds", []string{"gpu=a100"})
+	assert.Eventually(t, func() bool { return gpu.router.queueName(later) == "builds" }, 5*time.Second, 50*time.Millisecond)
+}
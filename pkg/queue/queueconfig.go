@@ -0,0 +1,269 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// QueueConfig is a queue defined with "qq queue add". Zero values mean the
+// worker's or job's own setting applies.
+type QueueConfig struct {
+	Name            string
+	MaxWorkers      int           // jobs a worker runs at once from the queue
+	DefaultTimeout  time.Duration // timeout of jobs that set none
+	DefaultPriority int           // priority of jobs added without one
+	Description     string
+	GlobalLimit     int // running jobs across all workers
+	CreatedAt       time.Time
+}
+
+func (cfg *QueueConfig) validate() error {
+	if cfg.Name == "" {
+		return fmt.Errorf("queue name is required")
+	}
+	if cfg.MaxWorkers < 0 {
+		return fmt.Errorf("max workers must not be negative")
+	}
+	if cfg.DefaultTimeout < 0 {
+		return fmt.Errorf("default timeout must not be negative")
+	}
+	if cfg.DefaultPriority < 0 || cfg.DefaultPriority > 4 {
+		return fmt.Errorf("default priority must be between 1 and 4")
+	}
+	if cfg.GlobalLimit < 0 {
+		return fmt.Errorf("global limit must not be negative")
+	}
+	return nil
+}
+
+// AddQueueConfig defines a queue
+func (q *QueueClient) AddQueueConfig(ctx context.Context, cfg *QueueConfig) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+
+	tag, err := q.pool.Exec(ctx, `
+		INSERT INTO queue_configs (name, max_workers, default_timeout_seconds, default_priority, description, global_limit)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (name) DO NOTHING
+	`, cfg.Name, cfg.MaxWorkers, timeoutSeconds(cfg.DefaultTimeout), cfg.DefaultPriority, cfg.Description, cfg.GlobalLimit)
+	if err != nil {
+		return fmt.Errorf("failed to add queue: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("queue %q already exists", cfg.Name)
+	}
+	return nil
+}
+
+// SetQueueConfig creates or replaces the definition of a queue. A changed
+// global limit applies to the next jobs workers start; the other settings
+// apply once the workers processing the queue restart.
+func (q *QueueClient) SetQueueConfig(ctx context.Context, cfg *QueueConfig) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+
+	_, err := q.pool.Exec(ctx, `
+		INSERT INTO queue_configs (name, max_workers, default_timeout_seconds, default_priority, description, global_limit)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (name) DO UPDATE SET
+			max_workers = EXCLUDED.max_workers,
+			default_timeout_seconds = EXCLUDED.default_timeout_seconds,
+			default_priority = EXCLUDED.default_priority,
+			description = EXCLUDED.description,
+			global_limit = EXCLUDED.global_limit
+	`, cfg.Name, cfg.MaxWorkers, timeoutSeconds(cfg.DefaultTimeout), cfg.DefaultPriority, cfg.Description, cfg.GlobalLimit)
+	if err != nil {
+		return fmt.Errorf("failed to set queue: %w", err)
+	}
+	return nil
+}
+
+// loadQueueConfigs retrieves the definitions of the named queues, or of all
+// queues if names is empty
+func loadQueueConfigs(ctx context.Context, pool *pgxpool.Pool, names []string) (map[string]QueueConfig, error) {
+	query := `
+		SELECT name, max_workers, default_timeout_seconds, default_priority, description, global_limit, created_at
+		FROM queue_configs
+	`
+	args := []interface{}{}
+	if len(names) > 0 {
+		query += " WHERE name = ANY($1)"
+		args = append(args, names)
+	}
+
+	rows, err := pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query queues: %w", err)
+	}
+	defer rows.Close()
+
+	configs := make(map[string]QueueConfig)
+	for rows.Next() {
+		var cfg QueueConfig
+		var timeoutSecs int
+		if err := rows.Scan(&cfg.Name, &cfg.MaxWorkers, &timeoutSecs, &cfg.DefaultPriority, &cfg.Description, &cfg.GlobalLimit, &cfg.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan queue: %w", err)
+		}
+		cfg.DefaultTimeout = time.Duration(timeoutSecs) * time.Second
+		configs[cfg.Name] = cfg
+	}
+	return configs, rows.Err()
+}
+
+// resolvePriority returns the priority a job is inserted with: its own, else
+// the default priority of its queue's definition, else 1
+func resolvePriority(priority int, queueName string, queueConfigs map[string]QueueConfig) int {
+	if priority > 0 {
+		return priority
+	}
+	if qc, ok := queueConfigs[queueName]; ok && qc.DefaultPriority > 0 {
+		return qc.DefaultPriority
+	}
+	return 1
+}
+
+// GetQueueConfig retrieves the definition of a queue, or nil if the queue
+// was never added with "qq queue add"
+func (q *QueueClient) GetQueueConfig(ctx context.Context, name string) (*QueueConfig, error) {
+	configs, err := loadQueueConfigs(ctx, q.pool, []string{name})
+	if err != nil {
+		return nil, err
+	}
+	cfg, ok := configs[name]
+	if !ok {
+		return nil, nil
+	}
+	return &cfg, nil
+}
+
+// RemoveQueue deletes a queue's definition. A queue that still has
+// unfinished jobs is only removed with force, which cancels them, killing
+// running commands, and returns how many were cancelled.
+func (q *QueueClient) RemoveQueue(ctx context.Context, name string, force bool) (int, error) {
+	jobTableName, err := resolveJobTableName(ctx, q.pool)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := q.pool.Query(ctx, fmt.Sprintf(`
+		SELECT id FROM %s
+		WHERE (queue = $1 OR queue IN (SELECT name FROM queue_routes WHERE queue = $1))
+			AND state NOT IN ('completed', 'cancelled', 'discarded')
+		ORDER BY id
+	`, jobTableName), name)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query queue jobs: %w", err)
+	}
+	jobIDs, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return 0, fmt.Errorf("failed to query queue jobs: %w", err)
+	}
+
+	if len(jobIDs) > 0 && !force {
+		return 0, fmt.Errorf("queue %q has %d unfinished jobs (use --force to cancel them)", name, len(jobIDs))
+	}
+
+	tag, err := q.pool.Exec(ctx, `DELETE FROM queue_configs WHERE name = $1`, name)
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove queue: %w", err)
+	}
+	if tag.RowsAffected() == 0 && len(jobIDs) == 0 {
+		return 0, fmt.Errorf("queue %q not found", name)
+	}
+
+	// Jobs that finish while they are being cancelled are fine to skip
+	cancelled := 0
+	for _, id := range jobIDs {
+		if err := q.RemoveJob(ctx, fmt.Sprintf("%d", id), true); err != nil {
+			if errors.Is(err, ErrJobFinished) {
+				continue
+			}
+			return cancelled, fmt.Errorf("failed to cancel job %d: %w", id, err)
+		}
+		cancelled++
+	}
+	return cancelled, nil
+}
+
+// acquireQueueSlot claims one of the running slots of a queue with a global
+// limit for a job. The queue's limit is read on every call, so changes apply
+// without restarting workers. It returns whether the job holds a slot, and
+// false for acquired if the queue is at its limit. Queues without a limit
+// need no slot, so their jobs take no lock.
+func acquireQueueSlot(ctx context.Context, pool *pgxpool.Pool, jobTableName, queueName string, jobID int64) (held, acquired bool, err error) {
+	limit, err := queueGlobalLimit(ctx, pool, queueName)
+	if err != nil || limit == 0 {
+		return false, err == nil, err
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return false, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Serialize workers claiming slots of the same queue
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('qq.queue_slots'), hashtext($1))`, queueName); err != nil {
+		return false, false, fmt.Errorf("failed to lock queue slots: %w", err)
+	}
+
+	// Slots of jobs that are no longer running were left behind by a
+	// worker that died, and are freed
+	_, err = tx.Exec(ctx, fmt.Sprintf(`
+		DELETE FROM queue_slots s
+		WHERE s.queue = $1 AND NOT EXISTS (
+			SELECT 1 FROM %s j WHERE j.id = s.job_id AND j.state = 'running'
+		)
+	`, jobTableName), queueName)
+	if err != nil {
+		return false, false, fmt.Errorf("failed to free queue slots: %w", err)
+	}
+
+	var used int
+	err = tx.QueryRow(ctx, `SELECT COUNT(*) FROM queue_slots WHERE queue = $1 AND job_id <> $2`, queueName, jobID).Scan(&used)
+	if err != nil {
+		return false, false, fmt.Errorf("failed to count queue slots: %w", err)
+	}
+	if used >= limit {
+		return false, false, nil
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO queue_slots (job_id, queue) VALUES ($1, $2)
+		ON CONFLICT (job_id) DO UPDATE SET queue = EXCLUDED.queue, acquired_at = NOW()
+	`, jobID, queueName)
+	if err != nil {
+		return false, false, fmt.Errorf("failed to acquire queue slot: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return false, false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return true, true, nil
+}
+
+// queueGlobalLimit reads the global limit of a queue, 0 for queues without
+// one or that were never added with "qq queue add"
+func queueGlobalLimit(ctx context.Context, pool *pgxpool.Pool, queueName string) (int, error) {
+	var limit int
+	err := pool.QueryRow(ctx, `SELECT global_limit FROM queue_configs WHERE name = $1`, queueName).Scan(&limit)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get queue limit: %w", err)
+	}
+	return limit, nil
+}
+
+// releaseQueueSlot frees the slot a job held, if it held one
+func releaseQueueSlot(ctx context.Context, pool *pgxpool.Pool, jobID int64) error {
+	_, err := pool.Exec(ctx, `DELETE FROM queue_slots WHERE job_id = $1`, jobID)
+	return err
+}
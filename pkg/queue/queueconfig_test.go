@@ -0,0 +1,87 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddQueueConfig_Validate(t *testing.T) {
+	q := &QueueClient{}
+	ctx := context.Background()
+
+	assert.EqualError(t, q.AddQueueConfig(ctx, &QueueConfig{}), "queue name is required")
+	assert.EqualError(t, q.AddQueueConfig(ctx, &QueueConfig{Name: "ci", MaxWorkers: -1}), "max workers must not be negative")
+	assert.EqualError(t, q.AddQueueConfig(ctx, &QueueConfig{Name: "ci", DefaultTimeout: -time.Minute}), "default timeout must not be negative")
+	assert.EqualError(t, q.AddQueueConfig(ctx, &QueueConfig{Name: "ci", DefaultPriority: 5}), "default priority must be between 1 and 4")
+}
+
+func TestQueueMaxWorkers(t *testing.T) {
+	queueConcurrency := map[string]int{"ci": 2}
+	queueConfigs := map[string]QueueConfig{
+		"ci":            {Name: "ci", MaxWorkers: 8},
+		"notifications": {Name: "notifications", MaxWorkers: 20},
+	}
+
+	// The worker's setting wins over the queue definition
+	assert.Equal(t, 2, queueMaxWorkers("ci", 5, queueConcurrency, queueConfigs, 0))
+	assert.Equal(t, 20, queueMaxWorkers("notifications", 5, queueConcurrency, queueConfigs, 0))
+	assert.Equal(t, 5, queueMaxWorkers("default", 5, queueConcurrency, queueConfigs, 0))
+
+	// No queue gets more than the total
+	assert.Equal(t, 10, queueMaxWorkers("notifications", 5, queueConcurrency, queueConfigs, 10))
+}
+
+func TestResolvePriority(t *testing.T) {
+	queueConfigs := map[string]QueueConfig{"ci": {Name: "ci", DefaultPriority: 2}}
+
+	assert.Equal(t, 3, resolvePriority(3, "ci", queueConfigs))
+	assert.Equal(t, 2, resolvePriority(0, "ci", queueConfigs))
+	assert.Equal(t, 1, resolvePriority(0, "default", queueConfigs))
+}
+
+func TestBashWorker_TotalConcurrency(t *testing.T) {
+	w := &BashWorker{slots: make(chan struct{}, 1)}
+	w.slots <- struct{}{}
+
+	// A job fetched while every slot is taken waits for one
+	done := make(chan error, 1)
+	go func() {
+		done <- w.Work(context.Background(), &river.Job[BashJobArgs]{
+			JobRow: &rivertype.JobRow{ID: 1, Attempt: 1},
+			Args:   BashJobArgs{Command: "true"},
+		})
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("job ran while every slot was taken: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	<-w.slots
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("job did not run once a slot was free")
+	}
+
+	// A job whose worker stops while it waits goes back to the queue
+	w.slots <- struct{}{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := w.Work(ctx, &river.Job[BashJobArgs]{JobRow: &rivertype.JobRow{ID: 2}})
+	var snooze *rivertype.JobSnoozeError
+	require.ErrorAs(t, err, &snooze)
+	assert.Zero(t, snooze.Duration)
+}
+
+func TestSetQueueConfig_Validate(t *testing.T) {
+	q := &QueueClient{}
+	err := q.SetQueueConfig(context.Background(), &QueueConfig{Name: "notifications", GlobalLimit: -1})
+	assert.EqualError(t, err, "global limit must not be negative")
+}
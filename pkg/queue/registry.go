@@ -0,0 +1,289 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+)
+
+// workerHeartbeatInterval is how often a worker updates its entry in the
+// workers table
+const workerHeartbeatInterval = 5 * time.Second
+
+// workerLostAfter is how long after its last heartbeat a worker that didn't
+// stop cleanly is reported as lost
+const workerLostAfter = 30 * time.Second
+
+// workerPruneAfter is how long lost workers stay in the workers table
+const workerPruneAfter = 24 * time.Hour
+
+// WorkerInfo is a qq worker process, as last reported by its heartbeat
+type WorkerInfo struct {
+	ID            string // River client ID
+	Hostname      string
+	PID           int
+	Version       string
+	Labels        map[string]string
+	Queues        []WorkerQueueInfo
+	RunningJobIDs []int64
+	JobsCompleted int64
+	StartedAt     time.Time
+	HeartbeatAt   time.Time
+	Lost          bool // the worker stopped heartbeating without shutting down
+	Draining      bool // the worker starts no new jobs and exits once its jobs finish
+}
+
+// WorkerQueueInfo represents a queue that a worker is processing
+type WorkerQueueInfo struct {
+	Name           string `json:"name"`
+	MaxWorkers     int    `json:"max_workers"`
+	NumJobsRunning int    `json:"running"`
+}
+
+// jobTracker keeps track of the jobs a worker is running and has finished,
+// for its heartbeat
+type jobTracker struct {
+	mu        sync.Mutex
+	running   map[int64]string // job ID to queue
+	completed int64
+}
+
+func newJobTracker() *jobTracker {
+	return &jobTracker{running: make(map[int64]string)}
+}
+
+func (t *jobTracker) start(jobID int64, queueName string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.running[jobID] = queueName
+}
+
+func (t *jobTracker) finish(jobID int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.running, jobID)
+	t.completed++
+}
+
+// snapshot returns the running job IDs in order, the number running per
+// queue, and the number of jobs completed
+func (t *jobTracker) snapshot() ([]int64, map[string]int, int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ids := make([]int64, 0, len(t.running))
+	perQueue := make(map[string]int)
+	for id, queueName := range t.running {
+		ids = append(ids, id)
+		perQueue[queueName]++
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, perQueue, t.completed
+}
+
+// workerRegistration is what a worker reports about itself in the workers
+// table
+type workerRegistration struct {
+	id       string
+	hostname string
+	pid      int
+	version  string
+	labels   map[string]string
+	queues   []WorkerQueueInfo // with the concurrency of each queue
+	jobs     *jobTracker
+}
+
+func newWorkerRegistration(id, version string, labels map[string]string, queues map[string]river.QueueConfig, jobs *jobTracker) *workerRegistration {
+	hostname, _ := os.Hostname()
+	reg := &workerRegistration{
+		id:       id,
+		hostname: hostname,
+		pid:      os.Getpid(),
+		version:  version,
+		labels:   labels,
+		jobs:     jobs,
+	}
+	if reg.labels == nil {
+		reg.labels = map[string]string{}
+	}
+	for name, qc := range queues {
+		reg.queues = append(reg.queues, WorkerQueueInfo{Name: name, MaxWorkers: qc.MaxWorkers})
+	}
+	sort.Slice(reg.queues, func(i, j int) bool { return reg.queues[i].Name < reg.queues[j].Name })
+	return reg
+}
+
+// save writes the worker's current state to the workers table, and returns
+// whether the worker was asked to drain. Registering starts the entry over,
+// e.g. for a restarted worker with a fixed --id.
+func (reg *workerRegistration) save(ctx context.Context, pool *pgxpool.Pool, register bool) (bool, error) {
+	runningIDs, perQueue, completed := reg.jobs.snapshot()
+	queues := make([]WorkerQueueInfo, len(reg.queues))
+	for i, qi := range reg.queues {
+		qi.NumJobsRunning = perQueue[qi.Name]
+		queues[i] = qi
+	}
+
+	restart := ""
+	if register {
+		restart = ", started_at = EXCLUDED.started_at, drain_requested_at = NULL"
+	}
+	var drain bool
+	err := pool.QueryRow(ctx, fmt.Sprintf(`
+		INSERT INTO workers (id, hostname, pid, version, labels, queues, running_job_ids, jobs_completed, started_at, heartbeat_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW(), NOW())
+		ON CONFLICT (id) DO UPDATE SET
+			hostname = EXCLUDED.hostname,
+			pid = EXCLUDED.pid,
+			version = EXCLUDED.version,
+			labels = EXCLUDED.labels,
+			queues = EXCLUDED.queues,
+			running_job_ids = EXCLUDED.running_job_ids,
+			jobs_completed = EXCLUDED.jobs_completed,
+			heartbeat_at = EXCLUDED.heartbeat_at%s
+		RETURNING drain_requested_at IS NOT NULL
+	`, restart), reg.id, reg.hostname, reg.pid, reg.version, reg.labels, queues, runningIDs, completed).Scan(&drain)
+	if err != nil {
+		return false, fmt.Errorf("failed to save worker: %w", err)
+	}
+	return drain, nil
+}
+
+// runHeartbeat updates the worker's entry until ctx is cancelled, and prunes
+// workers that have been lost for a long time and routes without jobs
+func (q *QueueClient) runHeartbeat(ctx context.Context) {
+	ticker := time.NewTicker(workerHeartbeatInterval)
+	defer ticker.Stop()
+	lastRouteCleanup := time.Now()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		drain, err := q.registration.save(ctx, q.pool, false)
+		if err != nil && ctx.Err() == nil {
+			fmt.Println("Failed to send worker heartbeat:", err)
+		}
+		if drain {
+			q.drainOnce.Do(func() { close(q.drainRequested) })
+		}
+		if time.Since(lastRouteCleanup) >= queueRouteCleanupInterval {
+			lastRouteCleanup = time.Now()
+			if err := removeUnusedRoutes(ctx, q.pool); err != nil && ctx.Err() == nil {
+				fmt.Println("Failed to remove unused queue routes:", err)
+			}
+		}
+		_, err = q.pool.Exec(ctx, `
+			DELETE FROM workers WHERE heartbeat_at < NOW() - make_interval(secs => $1)
+		`, workerPruneAfter.Seconds())
+		if err != nil && ctx.Err() == nil {
+			fmt.Println("Failed to prune lost workers:", err)
+		}
+	}
+}
+
+// ListWorkers retrieves the workers in the workers table. Workers remove
+// their entry when they shut down, so the ones that stopped heartbeating are
+// marked as lost.
+func (q *QueueClient) ListWorkers(ctx context.Context) ([]WorkerInfo, error) {
+	rows, err := q.pool.Query(ctx, `
+		SELECT id, hostname, pid, version, labels, queues, running_job_ids, jobs_completed, started_at, heartbeat_at,
+			heartbeat_at < NOW() - make_interval(secs => $1), drain_requested_at IS NOT NULL
+		FROM workers
+		ORDER BY started_at, id
+	`, workerLostAfter.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query workers: %w", err)
+	}
+	defer rows.Close()
+
+	var workers []WorkerInfo
+	for rows.Next() {
+		var w WorkerInfo
+		err := rows.Scan(&w.ID, &w.Hostname, &w.PID, &w.Version, &w.Labels, &w.Queues, &w.RunningJobIDs, &w.JobsCompleted,
+			&w.StartedAt, &w.HeartbeatAt, &w.Lost, &w.Draining)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan worker: %w", err)
+		}
+		workers = append(workers, w)
+	}
+	return workers, rows.Err()
+}
+
+// RequestWorkerDrain asks a worker to drain, as if it had received SIGTERM.
+// The worker sees the request on its next heartbeat.
+func (q *QueueClient) RequestWorkerDrain(ctx context.Context, id string) error {
+	tag, err := q.pool.Exec(ctx, `
+		UPDATE workers SET drain_requested_at = COALESCE(drain_requested_at, NOW()) WHERE id = $1
+	`, id)
+	if err != nil {
+		return fmt.Errorf("failed to request drain: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("worker %q not found", id)
+	}
+	return nil
+}
+
+// DrainRequested returns a channel that is closed when the worker is asked
+// to drain with RequestWorkerDrain. It is nil for insert-only clients.
+func (q *QueueClient) DrainRequested() <-chan struct{} {
+	return q.drainRequested
+}
+
+// Shutdown drains a worker: it stops fetching jobs and waits up to timeout
+// for running jobs to finish. Jobs still running then, or when ctx is
+// cancelled, are cancelled: their commands get the kill grace period to exit
+// and the jobs go back to their queue for another worker. The worker then
+// stops heartbeating and removes its entry from the workers table.
+func (q *QueueClient) Shutdown(ctx context.Context, timeout time.Duration) error {
+	if q.stopCron != nil {
+		q.stopCron()
+	}
+	if q.stopRoutes != nil {
+		q.stopRoutes()
+	}
+	if q.registration != nil {
+		// Show the worker as draining whether it was asked to or got a signal
+		_, err := q.pool.Exec(ctx, `
+			UPDATE workers SET drain_requested_at = COALESCE(drain_requested_at, NOW()) WHERE id = $1
+		`, q.registration.id)
+		if err != nil {
+			fmt.Println("Failed to mark worker as draining:", err)
+		}
+	}
+
+	stopCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err := q.client.Stop(stopCtx)
+	if err != nil && stopCtx.Err() != nil {
+		if ctx.Err() == nil {
+			fmt.Printf("Jobs still running after %s, cancelling them...\n", timeout)
+		}
+		err = q.client.StopAndCancel(context.WithoutCancel(ctx))
+	}
+
+	q.deregister(ctx)
+	return err
+}
+
+// deregister stops the heartbeat of a worker client and removes its entry
+// from the workers table
+func (q *QueueClient) deregister(ctx context.Context) {
+	if q.stopHeartbeat == nil {
+		return
+	}
+	q.stopHeartbeat()
+	<-q.heartbeatDone
+	if _, err := q.pool.Exec(context.WithoutCancel(ctx), `DELETE FROM workers WHERE id = $1`, q.registration.id); err != nil {
+		fmt.Println("Failed to remove worker:", err)
+	}
+}
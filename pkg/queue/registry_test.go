@@ -0,0 +1,36 @@
+package queue
+
+import (
+	"testing"
+
+	"github.com/riverqueue/river"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobTracker(t *testing.T) {
+	jobs := newJobTracker()
+	jobs.start(7, "ci")
+	jobs.start(3, "ci")
+	jobs.start(5, "default")
+	jobs.finish(3)
+
+	ids, perQueue, completed := jobs.snapshot()
+	assert.Equal(t, []int64{5, 7}, ids)
+	assert.Equal(t, map[string]int{"ci": 1, "default": 1}, perQueue)
+	assert.Equal(t, int64(1), completed)
+}
+
+func TestNewWorkerRegistration(t *testing.T) {
+	reg := newWorkerRegistration("w1", "1.2.3", nil, map[string]river.QueueConfig{
+		"notifications": {MaxWorkers: 20},
+		"ci":            {MaxWorkers: 2},
+	}, newJobTracker())
+
+	assert.Equal(t, "w1", reg.id)
+	assert.NotZero(t, reg.pid)
+	assert.NotNil(t, reg.labels)
+	assert.Equal(t, []WorkerQueueInfo{
+		{Name: "ci", MaxWorkers: 2},
+		{Name: "notifications", MaxWorkers: 20},
+	}, reg.queues)
+}
@@ -0,0 +1,84 @@
+package queue
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"time"
+)
+
+// Backoff strategies for RetryPolicy
+const (
+	BackoffFixed       = "fixed"
+	BackoffExponential = "exponential"
+)
+
+// defaultRetryDelay is the base delay used when a retry policy sets none
+const defaultRetryDelay = 10 * time.Second
+
+// maxRetryDelay caps exponential backoff for policies without a MaxDelay
+const maxRetryDelay = 24 * time.Hour
+
+// RetryPolicy controls whether and when a failed job is retried. Jobs
+// without a policy are never retried. Durations are encoded in job args as
+// nanoseconds, like time.Duration.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first.
+	// It is stored in River's own max_attempts column rather than the args.
+	MaxAttempts int           `json:"-" yaml:"max_attempts"`
+	Backoff     string        `json:"backoff,omitempty" yaml:"backoff,omitempty"`       // fixed or exponential (default)
+	Delay       time.Duration `json:"delay,omitempty" yaml:"delay,omitempty"`           // delay before the first retry (default 10s)
+	MaxDelay    time.Duration `json:"max_delay,omitempty" yaml:"max_delay,omitempty"`   // cap for exponential backoff (default 24h)
+	Jitter      bool          `json:"jitter,omitempty" yaml:"jitter,omitempty"`         // randomize delays to spread out retries
+	ExitCodes   []int         `json:"exit_codes,omitempty" yaml:"exit_codes,omitempty"` // retryable exit codes (empty = any failure)
+}
+
+// Validate checks the retry policy for errors
+func (p *RetryPolicy) Validate() error {
+	if p.MaxAttempts < 1 {
+		return fmt.Errorf("max_attempts must be at least 1")
+	}
+	if p.Backoff != "" && p.Backoff != BackoffFixed && p.Backoff != BackoffExponential {
+		return fmt.Errorf("invalid backoff %q (must be '%s' or '%s')", p.Backoff, BackoffFixed, BackoffExponential)
+	}
+	if p.Delay < 0 || p.MaxDelay < 0 {
+		return fmt.Errorf("retry delays must not be negative")
+	}
+	return nil
+}
+
+// Retryable reports whether a failure with the given exit code may be retried
+func (p *RetryPolicy) Retryable(exitCode int) bool {
+	return len(p.ExitCodes) == 0 || slices.Contains(p.ExitCodes, exitCode)
+}
+
+// delayFor returns the delay before retrying after the given failed attempt
+// (1-based), without jitter
+func (p *RetryPolicy) delayFor(attempt int) time.Duration {
+	delay := p.Delay
+	if delay <= 0 {
+		delay = defaultRetryDelay
+	}
+	if p.Backoff == BackoffFixed {
+		return delay
+	}
+
+	maxDelay := p.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = maxRetryDelay
+	}
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxDelay)
+}
+
+// nextRetryAt returns when the given failed attempt should be retried. With
+// jitter the delay is drawn uniformly from [delay/2, delay].
+func (p *RetryPolicy) nextRetryAt(now time.Time, attempt int) time.Time {
+	delay := p.delayFor(attempt)
+	if p.Jitter && delay > 1 {
+		delay = delay/2 + rand.N(delay/2)
+	}
+	return now.Add(delay)
+}
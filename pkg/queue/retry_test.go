@@ -0,0 +1,75 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryPolicy_Validate(t *testing.T) {
+	assert.NoError(t, (&RetryPolicy{MaxAttempts: 3}).Validate())
+	assert.EqualError(t, (&RetryPolicy{}).Validate(), "max_attempts must be at least 1")
+	assert.EqualError(t, (&RetryPolicy{MaxAttempts: 3, Backoff: "linear"}).Validate(),
+		"invalid backoff \"linear\" (must be 'fixed' or 'exponential')")
+	assert.EqualError(t, (&RetryPolicy{MaxAttempts: 3, Delay: -time.Second}).Validate(),
+		"retry delays must not be negative")
+}
+
+func TestRetryPolicy_Retryable(t *testing.T) {
+	assert.True(t, (&RetryPolicy{}).Retryable(1))
+	assert.True(t, (&RetryPolicy{}).Retryable(ExitCodeTimeout))
+
+	p := &RetryPolicy{ExitCodes: []int{75, 111}}
+	assert.True(t, p.Retryable(75))
+	assert.False(t, p.Retryable(1))
+}
+
+func TestRetryPolicy_DelayFor(t *testing.T) {
+	fixed := &RetryPolicy{Backoff: BackoffFixed, Delay: 5 * time.Second}
+	assert.Equal(t, 5*time.Second, fixed.delayFor(1))
+	assert.Equal(t, 5*time.Second, fixed.delayFor(4))
+
+	exp := &RetryPolicy{Delay: time.Second, MaxDelay: 10 * time.Second}
+	assert.Equal(t, time.Second, exp.delayFor(1))
+	assert.Equal(t, 2*time.Second, exp.delayFor(2))
+	assert.Equal(t, 8*time.Second, exp.delayFor(4))
+	assert.Equal(t, 10*time.Second, exp.delayFor(5))
+
+	// Defaults: 10s base, capped at 24h even after many attempts
+	assert.Equal(t, defaultRetryDelay, (&RetryPolicy{}).delayFor(1))
+	assert.Equal(t, maxRetryDelay, (&RetryPolicy{}).delayFor(100))
+}
+
+func TestRetryPolicy_NextRetryAtJitter(t *testing.T) {
+	now := time.Now()
+	p := &RetryPolicy{Backoff: BackoffFixed, Delay: 10 * time.Second, Jitter: true}
+	for i := 0; i < 100; i++ {
+		next := p.nextRetryAt(now, 1)
+		require.False(t, next.Before(now.Add(5*time.Second)))
+		require.False(t, next.After(now.Add(10*time.Second)))
+	}
+}
+
+func TestParseApplyFileBytes_Retry(t *testing.T) {
+	af, err := ParseApplyFileBytes([]byte(`
+jobs:
+  - name: fetch
+    command: "curl -f https://example.com"
+    retry:
+      max_attempts: 5
+      backoff: fixed
+      delay: 30s
+      exit_codes: [6, 7]
+`))
+	require.NoError(t, err)
+	require.NotNil(t, af.Jobs[0].Retry)
+	assert.Equal(t, &RetryPolicy{
+		MaxAttempts: 5,
+		Backoff:     BackoffFixed,
+		Delay:       30 * time.Second,
+		ExitCodes:   []int{6, 7},
+	}, af.Jobs[0].Retry)
+	assert.NoError(t, af.Validate())
+}
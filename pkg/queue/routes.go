@@ -0,0 +1,404 @@
+package queue
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+)
+
+// maxRiverQueueName is the longest queue name River accepts
+const maxRiverQueueName = 64
+
+// maxQueueRoutes is how many different requirements a queue can have
+// unfinished jobs for at a time. Workers fetch from each route they add
+// until they restart, so this keeps their number of River queues bounded.
+const maxQueueRoutes = 16
+
+// queueRouteCleanupInterval is how often a worker removes the routes that
+// have no jobs left, and how long a route stays after its last job was added
+const queueRouteCleanupInterval = time.Hour
+
+// routeListenRetryInterval is how long a worker waits before listening for
+// new routes again after losing its connection
+const routeListenRetryInterval = 5 * time.Second
+
+// routeSuffix matches the end of the River queue of a route
+var routeSuffix = regexp.MustCompile(`-req-[0-9a-f]{12}$`)
+
+// River fetches jobs by queue only. So that workers whose labels don't
+// satisfy a job's requirements never fetch it, a job with requirements is
+// inserted into a River queue of its own for its queue and requirements, a
+// route. Routes are recorded in queue_routes. Each worker adds the routes of
+// its queues that its labels satisfy to its River client when it starts, and
+// then as jobs are inserted into new routes, which River notifies.
+
+// canonicalRequirements returns requirements in a canonical form: each
+// selector normalized, sorted and without duplicates, so that equivalent
+// requirements share a route
+func canonicalRequirements(requires []string) []string {
+	seen := make(map[string]bool, len(requires))
+	canonical := make([]string, 0, len(requires))
+	for _, s := range requires {
+		sel, err := parseSelector(s)
+		if err != nil {
+			continue
+		}
+		c := sel.String()
+		if !seen[c] {
+			seen[c] = true
+			canonical = append(canonical, c)
+		}
+	}
+	sort.Strings(canonical)
+	return canonical
+}
+
+// String formats the selector the way parseSelector reads it
+func (sel selector) String() string {
+	switch {
+	case sel.exists && sel.negate:
+		return "!" + sel.key
+	case sel.exists:
+		return sel.key
+	case sel.negate:
+		return sel.key + "!=" + sel.value
+	default:
+		return sel.key + "=" + sel.value
+	}
+}
+
+// routedQueueName returns the River queue that jobs of a queue with the
+// given requirements are inserted into: the queue's name, shortened to fit
+// River's limit if needed, with a hash of the queue and requirements
+func routedQueueName(queueName string, requires []string) string {
+	sum := sha256.Sum256([]byte(queueName + "\x00" + strings.Join(canonicalRequirements(requires), "\x00")))
+	suffix := "-req-" + hex.EncodeToString(sum[:6])
+	prefix := queueName
+	if max := maxRiverQueueName - len(suffix); len(prefix) > max {
+		prefix = strings.TrimRight(prefix[:max], "_-")
+	}
+	return prefix + suffix
+}
+
+// routeQueueTx returns the River queue a job of the queue with the given
+// requirements is inserted into, recording the route in queue_routes. Jobs
+// without requirements go into the queue itself. A new route is rejected
+// once the queue has maxQueueRoutes routes in use.
+func routeQueueTx(ctx context.Context, pool *pgxpool.Pool, tx pgx.Tx, queueName string, requires []string) (string, error) {
+	canonical := canonicalRequirements(requires)
+	if len(canonical) == 0 {
+		return queueName, nil
+	}
+	name := routedQueueName(queueName, canonical)
+
+	// Routes are in use while they have unfinished jobs, or have just been
+	// used in this transaction, e.g. by earlier jobs of a pipeline
+	jobTableName, err := resolveJobTableName(ctx, pool)
+	if err != nil {
+		return "", err
+	}
+	rows, err := tx.Query(ctx, fmt.Sprintf(`
+		SELECT r.name FROM queue_routes r
+		WHERE r.queue = $1
+		AND (r.used_at = NOW() OR EXISTS (
+			SELECT 1 FROM %s j
+			WHERE j.queue = r.name
+			AND j.state IN ('available', 'pending', 'retryable', 'running', 'scheduled')
+		))
+	`, jobTableName), queueName)
+	if err != nil {
+		return "", fmt.Errorf("failed to query queue routes (run `qq init` to create the queue_routes table): %w", err)
+	}
+	inUse, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return "", fmt.Errorf("failed to query queue routes: %w", err)
+	}
+	if len(inUse) >= maxQueueRoutes && !slices.Contains(inUse, name) {
+		return "", &ValidationError{Err: fmt.Errorf("queue %q already has unfinished jobs with %d different requirements; wait for some of them to finish", queueName, maxQueueRoutes)}
+	}
+
+	// Recording the use of an existing route locks it, so it isn't removed
+	// as unused before the job is committed
+	_, err = tx.Exec(ctx, `
+		INSERT INTO queue_routes (name, queue, requires)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (name) DO UPDATE SET used_at = EXCLUDED.used_at
+	`, name, queueName, canonical)
+	if err != nil {
+		return "", fmt.Errorf("failed to record queue route: %w", err)
+	}
+	return name, nil
+}
+
+// queueRoutes returns the River queues of the routes of a queue
+func queueRoutes(ctx context.Context, pool *pgxpool.Pool, queueName string) ([]string, error) {
+	rows, err := pool.Query(ctx, `SELECT name FROM queue_routes WHERE queue = $1 ORDER BY name`, queueName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query queue routes: %w", err)
+	}
+	names, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("failed to query queue routes: %w", err)
+	}
+	return names, nil
+}
+
+// removeUnusedRoutes deletes the routes whose jobs are all gone, once River
+// has cleaned up their finished jobs. River can't stop fetching from a queue,
+// so workers that added a removed route keep it until they restart; a job
+// with the same queue and requirements records it again under the same name.
+func removeUnusedRoutes(ctx context.Context, pool *pgxpool.Pool) error {
+	jobTableName, err := resolveJobTableName(ctx, pool)
+	if err != nil {
+		return err
+	}
+	_, err = pool.Exec(ctx, fmt.Sprintf(`
+		DELETE FROM queue_routes r
+		WHERE r.used_at < NOW() - make_interval(secs => $1)
+		AND NOT EXISTS (SELECT 1 FROM %s j WHERE j.queue = r.name)
+	`, jobTableName), queueRouteCleanupInterval.Seconds())
+	return err
+}
+
+// queueRouter keeps track of the routes a worker processes. River reports
+// a job's route as its queue, which the router maps back to the qq queue.
+type queueRouter struct {
+	queues map[string]river.QueueConfig // the worker's queues
+	labels map[string]string
+
+	mu     sync.RWMutex
+	routes map[string]string // River queue of a route to its queue
+	// ignored holds the routes the worker doesn't process. A route's name
+	// is derived from its queue and requirements, so that never changes.
+	ignored map[string]bool
+}
+
+func newQueueRouter(queues map[string]river.QueueConfig, labels map[string]string) *queueRouter {
+	return &queueRouter{
+		queues:  queues,
+		labels:  labels,
+		routes:  make(map[string]string),
+		ignored: make(map[string]bool),
+	}
+}
+
+// queueName returns the queue a job fetched from a River queue belongs to
+func (r *queueRouter) queueName(riverQueue string) string {
+	if r == nil {
+		return riverQueue
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if name, ok := r.routes[riverQueue]; ok {
+		return name
+	}
+	return riverQueue
+}
+
+// needsDiscovery reports whether a River queue is a route the worker has
+// yet to decide about
+func (r *queueRouter) needsDiscovery(riverQueue string) bool {
+	if !routeSuffix.MatchString(riverQueue) {
+		return false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, known := r.routes[riverQueue]
+	return !known && !r.ignored[riverQueue]
+}
+
+// route is an entry of queue_routes
+type route struct {
+	name, queue string
+	requires    []string
+}
+
+// discover adds the routes of the worker's queues that its labels satisfy
+// and it doesn't process yet to the River client
+func (r *queueRouter) discover(ctx context.Context, pool *pgxpool.Pool, client *river.Client[pgx.Tx]) error {
+	names := make([]string, 0, len(r.queues))
+	for name := range r.queues {
+		names = append(names, name)
+	}
+	return r.addRoutes(ctx, pool, client, `WHERE queue = ANY($1) ORDER BY name`, names)
+}
+
+// discoverRoute adds a single route to the River client if the worker
+// processes its queue and its labels satisfy its requirements
+func (r *queueRouter) discoverRoute(ctx context.Context, pool *pgxpool.Pool, client *river.Client[pgx.Tx], name string) error {
+	return r.addRoutes(ctx, pool, client, `WHERE name = $1`, name)
+}
+
+func (r *queueRouter) addRoutes(ctx context.Context, pool *pgxpool.Pool, client *river.Client[pgx.Tx], where string, arg any) error {
+	rows, err := pool.Query(ctx, `SELECT name, queue, requires FROM queue_routes `+where, arg)
+	if err != nil {
+		return fmt.Errorf("failed to query queue routes: %w", err)
+	}
+	routes, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (route, error) {
+		var rt route
+		err := row.Scan(&rt.name, &rt.queue, &rt.requires)
+		return rt, err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to query queue routes: %w", err)
+	}
+
+	for _, rt := range routes {
+		if !r.needsDiscovery(rt.name) {
+			continue
+		}
+		qc, ok := r.queues[rt.queue]
+		if !ok || !MatchLabels(rt.requires, r.labels) {
+			r.mu.Lock()
+			r.ignored[rt.name] = true
+			r.mu.Unlock()
+			continue
+		}
+
+		// River reads whether a queue is paused when it starts fetching
+		// from it, and only pauses queues it has fetched from. So a route
+		// of a paused queue is added when its queue is resumed, which
+		// notifies its routes, unless pausing the queue paused it too.
+		paused, err := queuePaused(ctx, client, rt.queue)
+		if err != nil {
+			return err
+		}
+		if paused {
+			if _, err := client.QueueGet(ctx, rt.name); errors.Is(err, rivertype.ErrNotFound) {
+				continue
+			} else if err != nil {
+				return fmt.Errorf("failed to get queue route %s: %w", rt.name, err)
+			}
+		}
+
+		if err := client.Queues().Add(rt.name, qc); err != nil {
+			return fmt.Errorf("failed to add queue route %s: %w", rt.name, err)
+		}
+		r.mu.Lock()
+		r.routes[rt.name] = rt.queue
+		r.mu.Unlock()
+	}
+	return nil
+}
+
+// queuePaused reports whether a queue is paused
+func queuePaused(ctx context.Context, client *river.Client[pgx.Tx], name string) (bool, error) {
+	queue, err := client.QueueGet(ctx, name)
+	if errors.Is(err, rivertype.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get queue %s: %w", name, err)
+	}
+	return queue.PausedAt != nil, nil
+}
+
+// notifyRoutes tells workers that a queue's routes have jobs to fetch, the
+// way River notifies inserted jobs
+func notifyRoutes(ctx context.Context, pool *pgxpool.Pool, routes []string) error {
+	_, err := pool.Exec(ctx, `
+		SELECT pg_notify(current_schema() || '.river_insert', json_build_object('queue', name)::text)
+		FROM unnest($1::text[]) AS name
+	`, routes)
+	if err != nil {
+		return fmt.Errorf("failed to notify queue routes: %w", err)
+	}
+	return nil
+}
+
+// runRouteListener adds new routes to a worker as jobs are inserted into
+// them, until ctx is cancelled. River notifies the insert of available jobs,
+// the release trigger created by qq init that of jobs whose dependencies
+// finished, and ResumeQueue the routes of a resumed queue.
+func (q *QueueClient) runRouteListener(ctx context.Context) {
+	for {
+		err := q.listenForRoutes(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		fmt.Println("Failed to listen for queue routes:", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(routeListenRetryInterval):
+		}
+	}
+}
+
+func (q *QueueClient) listenForRoutes(ctx context.Context) error {
+	pooled, err := q.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// A listening connection doesn't go back to the pool
+	conn := pooled.Hijack()
+	defer conn.Close(context.WithoutCancel(ctx))
+
+	var schema string
+	if err := conn.QueryRow(ctx, `SELECT current_schema()`).Scan(&schema); err != nil {
+		return err
+	}
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{schema + ".river_insert"}.Sanitize()); err != nil {
+		return err
+	}
+
+	// Catch up on the routes added while the worker wasn't listening
+	if err := q.router.discover(ctx, q.pool, q.client); err != nil {
+		return err
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		var payload struct {
+			Queue string `json:"queue"`
+		}
+		if err := json.Unmarshal([]byte(notification.Payload), &payload); err != nil {
+			continue
+		}
+		if !q.router.needsDiscovery(payload.Queue) {
+			continue
+		}
+		if err := q.router.discoverRoute(ctx, q.pool, q.client, payload.Queue); err != nil && ctx.Err() == nil {
+			fmt.Println("Failed to add queue route:", err)
+		}
+	}
+}
+
+// reroute moves a job with requirements that was fetched from its queue
+// itself, e.g. one added before routes existed, into its route, where only
+// workers whose labels satisfy them fetch it
+func (w *BashWorker) reroute(ctx context.Context, job *river.Job[BashJobArgs], queueName string) error {
+	fmt.Printf("Job %d requires %s, which this worker's labels don't satisfy; moving it to its route\n",
+		job.ID, strings.Join(job.Args.Requires, ", "))
+	if w.pool != nil {
+		err := pgx.BeginFunc(ctx, w.pool, func(tx pgx.Tx) error {
+			name, err := routeQueueTx(ctx, w.pool, tx, queueName, job.Args.Requires)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(ctx, fmt.Sprintf(`UPDATE %s SET queue = $2 WHERE id = $1`, w.jobTableName), job.ID, name)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to move job to its route: %w", err)
+		}
+	}
+	return river.JobSnooze(0)
+}
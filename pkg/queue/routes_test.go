@@ -0,0 +1,102 @@
+package queue
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonicalRequirements(t *testing.T) {
+	assert.Equal(t, []string{"!spot", "gpu", "os!=darwin", "os=linux"},
+		canonicalRequirements([]string{" os = linux", "gpu", "os!=darwin", "!spot", "gpu"}))
+	assert.Empty(t, canonicalRequirements(nil))
+}
+
+func TestRoutedQueueName(t *testing.T) {
+	// River's rule for queue names
+	riverName := regexp.MustCompile(`^(?:[a-z0-9])+(?:[_|\-]?[a-z0-9]+)*$`)
+
+	name := routedQueueName("builds", []string{"os=linux", "gpu"})
+	assert.True(t, strings.HasPrefix(name, "builds-req-"), name)
+	assert.Regexp(t, riverName, name)
+
+	// Equivalent requirements share a route; others and other queues don't
+	assert.Equal(t, name, routedQueueName("builds", []string{"gpu", "os = linux", "gpu"}))
+	assert.NotEqual(t, name, routedQueueName("builds", []string{"gpu"}))
+	assert.NotEqual(t, name, routedQueueName("tests", []string{"os=linux", "gpu"}))
+
+	// Long queue names are shortened to fit River's limit
+	long := strings.Repeat("a", 60) + "_b"
+	name = routedQueueName(long, []string{"gpu"})
+	assert.LessOrEqual(t, len(name), maxRiverQueueName)
+	assert.Regexp(t, riverName, name)
+	assert.NotEqual(t, name, routedQueueName(strings.Repeat("a", 60)+"_c", []string{"gpu"}))
+}
+
+func TestQueueRouter_QueueName(t *testing.T) {
+	r := newQueueRouter(map[string]river.QueueConfig{"builds": {MaxWorkers: 2}}, nil)
+	route := routedQueueName("builds", []string{"gpu"})
+	r.routes[route] = "builds"
+
+	assert.Equal(t, "builds", r.queueName(route))
+	assert.Equal(t, "builds", r.queueName("builds"))
+
+	// Workers without a router process no routes
+	var none *queueRouter
+	assert.Equal(t, "builds", none.queueName("builds"))
+}
+
+func TestQueueRouter_NeedsDiscovery(t *testing.T) {
+	r := newQueueRouter(map[string]river.QueueConfig{"builds": {MaxWorkers: 2}}, nil)
+	added := routedQueueName("builds", []string{"gpu"})
+	r.routes[added] = "builds"
+	ignored := routedQueueName("builds", []string{"os=darwin"})
+	r.ignored[ignored] = true
+
+	assert.True(t, r.needsDiscovery(routedQueueName("builds", []string{"os=linux"})))
+	assert.False(t, r.needsDiscovery(added))
+	assert.False(t, r.needsDiscovery(ignored))
+
+	// Inserts into queues that aren't routes never trigger discovery
+	assert.False(t, r.needsDiscovery("builds"))
+	assert.False(t, r.needsDiscovery("tests"))
+}
+
+func TestBashWorker_QueueConcurrencyAcrossRoutes(t *testing.T) {
+	route := routedQueueName("builds", []string{"gpu"})
+	w := &BashWorker{
+		labels:     map[string]string{"gpu": "a100"},
+		queueSlots: map[string]chan struct{}{"builds": make(chan struct{}, 1)},
+		router:     newQueueRouter(map[string]river.QueueConfig{"builds": {MaxWorkers: 1}}, nil),
+	}
+	w.router.routes[route] = "builds"
+
+	// A job from a route waits while a job of the queue itself runs
+	w.queueSlots["builds"] <- struct{}{}
+	done := make(chan error, 1)
+	go func() {
+		done <- w.Work(context.Background(), &river.Job[BashJobArgs]{
+			JobRow: &rivertype.JobRow{ID: 1, Attempt: 1, Queue: route},
+			Args:   BashJobArgs{Command: "true", Requires: []string{"gpu"}},
+		})
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("job ran while its queue's slot was taken: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	<-w.queueSlots["builds"]
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("job did not run once its queue's slot was free")
+	}
+}
@@ -0,0 +1,108 @@
+package queue
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Layouts accepted for a date and time of day in ParseScheduleTime
+var scheduleDateTimeLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// Layouts accepted for a time of day in ParseScheduleTime
+var scheduleClockLayouts = []string{
+	"15:04:05",
+	"15:04",
+}
+
+// ParseScheduleTime parses the time a job should run at. It accepts
+// RFC3339, a Unix timestamp in seconds, a date with an optional time of day
+// ("2025-03-01 02:00"), or a time of day that may be preceded by "today" or
+// "tomorrow" ("tomorrow 02:00"). Dates and times without an offset are in
+// loc. A bare time of day is its next occurrence after now.
+func ParseScheduleTime(s string, loc *time.Location, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if loc == nil {
+		loc = time.Local
+	}
+	now = now.In(loc)
+
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if unix, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(unix, 0), nil
+	}
+	for _, layout := range scheduleDateTimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+
+	// A time of day, relative to today
+	day, clock, hasDay := strings.Cut(strings.ToLower(s), " ")
+	if !hasDay {
+		day, clock = "", day
+	}
+	var offset int
+	switch day {
+	case "":
+	case "today":
+	case "tomorrow":
+		offset = 1
+	default:
+		return time.Time{}, invalidScheduleTime(s)
+	}
+	for _, layout := range scheduleClockLayouts {
+		c, err := time.Parse(layout, strings.TrimSpace(clock))
+		if err != nil {
+			continue
+		}
+		t := time.Date(now.Year(), now.Month(), now.Day()+offset, c.Hour(), c.Minute(), c.Second(), 0, loc)
+		if day == "" && !t.After(now) {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	return time.Time{}, invalidScheduleTime(s)
+}
+
+func invalidScheduleTime(s string) error {
+	return fmt.Errorf("invalid schedule time %q (use RFC3339, a Unix timestamp, \"2006-01-02 15:04\" or \"[today|tomorrow] 15:04\")", s)
+}
+
+// LoadScheduleLocation returns the time zone schedule times are read in.
+// An empty name is the local time zone.
+func LoadScheduleLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone %q: %w", name, err)
+	}
+	return loc, nil
+}
+
+// scheduledAt returns when a pipeline job should run, or the zero time if
+// it should run as soon as its dependencies allow
+func (job *ApplyJob) scheduledAt(now time.Time) (time.Time, error) {
+	if job.Delay > 0 {
+		return now.Add(job.Delay), nil
+	}
+	if job.Schedule == "" {
+		return time.Time{}, nil
+	}
+	loc, err := LoadScheduleLocation(job.Timezone)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return ParseScheduleTime(job.Schedule, loc, now)
+}
@@ -0,0 +1,78 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseScheduleTime(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	now := time.Date(2025, 3, 1, 10, 30, 0, 0, berlin)
+
+	tests := []struct {
+		input string
+		want  time.Time
+	}{
+		{"2025-03-05T08:00:00Z", time.Date(2025, 3, 5, 8, 0, 0, 0, time.UTC)},
+		{"1741161600", time.Unix(1741161600, 0)},
+		{"2025-03-05 08:00", time.Date(2025, 3, 5, 8, 0, 0, 0, berlin)},
+		{"2025-03-05", time.Date(2025, 3, 5, 0, 0, 0, 0, berlin)},
+		{"tomorrow 02:00", time.Date(2025, 3, 2, 2, 0, 0, 0, berlin)},
+		{"Today 17:30", time.Date(2025, 3, 1, 17, 30, 0, 0, berlin)},
+		{"12:00", time.Date(2025, 3, 1, 12, 0, 0, 0, berlin)},
+		// A bare time of day that has passed is tomorrow's
+		{"09:15:30", time.Date(2025, 3, 2, 9, 15, 30, 0, berlin)},
+	}
+	for _, tt := range tests {
+		got, err := ParseScheduleTime(tt.input, berlin, now)
+		require.NoError(t, err, tt.input)
+		assert.True(t, tt.want.Equal(got), "%s: got %s, want %s", tt.input, got, tt.want)
+	}
+
+	_, err = ParseScheduleTime("next week", berlin, now)
+	assert.Error(t, err)
+	_, err = ParseScheduleTime("tomorrow 25:00", berlin, now)
+	assert.Error(t, err)
+}
+
+func TestParseApplyFileBytes_ScheduleAndDelay(t *testing.T) {
+	af, err := ParseApplyFileBytes([]byte(`
+timezone: Europe/Berlin
+vars:
+  date: "2025-03-05"
+jobs:
+  - name: backup
+    command: "./backup.sh"
+    schedule: "{{ .vars.date }} 02:00"
+  - name: cleanup
+    command: "./cleanup.sh"
+    delay: 15m
+`))
+	require.NoError(t, err)
+	require.NoError(t, af.Validate())
+	require.NoError(t, af.Render())
+
+	now := time.Now()
+	at, err := af.Jobs[0].scheduledAt(now)
+	require.NoError(t, err)
+	assert.Equal(t, "2025-03-05T02:00:00+01:00", at.Format(time.RFC3339))
+
+	at, err = af.Jobs[1].scheduledAt(now)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(15*time.Minute), at)
+}
+
+func TestValidate_ScheduleErrors(t *testing.T) {
+	af := &ApplyFile{Jobs: []ApplyJob{{Name: "a", Command: "echo a", Schedule: "02:00", Delay: time.Minute}}}
+	assert.EqualError(t, af.Validate(), `job "a" can't have both a schedule and a delay`)
+
+	af = &ApplyFile{Jobs: []ApplyJob{{Name: "a", Command: "echo a", Schedule: "someday"}}}
+	assert.ErrorContains(t, af.Validate(), `job "a": invalid schedule time "someday"`)
+
+	af = &ApplyFile{Jobs: []ApplyJob{{Name: "a", Command: "echo a", Schedule: "02:00", Timezone: "Mars/Olympus"}}}
+	assert.ErrorContains(t, af.Validate(), `job "a": invalid time zone "Mars/Olympus"`)
+}
@@ -0,0 +1,172 @@
+package queue
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ParseVarAssignments parses key=value strings, as given to
+// "qq apply --var", into a map
+func ParseVarAssignments(assignments []string) (map[string]string, error) {
+	vars := make(map[string]string, len(assignments))
+	for _, a := range assignments {
+		key, value, ok := strings.Cut(a, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid variable %q (expected key=value)", a)
+		}
+		vars[key] = value
+	}
+	return vars, nil
+}
+
+// ParseVarFile reads pipeline variables from a YAML file of key: value pairs
+func ParseVarFile(filePath string) (map[string]string, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read var file: %w", err)
+	}
+	var vars map[string]string
+	if err := yaml.Unmarshal(data, &vars); err != nil {
+		return nil, fmt.Errorf("failed to parse var file %s: %w", filePath, err)
+	}
+	return vars, nil
+}
+
+// SetVars overrides the variables of the pipeline's vars block
+func (af *ApplyFile) SetVars(vars map[string]string) {
+	af.Vars = mergeEnv(af.Vars, vars)
+}
+
+// Render expands {{ .vars.x }} and {{ .matrix.axis }} templates in the
+// command, queue, env, workdir and schedule of every job, and {{ .vars.x }}
+// in the pipeline-level env and workdir
+func (af *ApplyFile) Render() error {
+	return af.renderJobs(true)
+}
+
+// renderJobs expands the templates of the pipeline, and stores the result
+// when apply is set. Without apply it only reports the first error.
+func (af *ApplyFile) renderJobs(apply bool) error {
+	data := map[string]any{"vars": af.Vars, "matrix": map[string]string(nil)}
+
+	workdir, err := renderTemplate("workdir", af.Workdir, data)
+	if err != nil {
+		return err
+	}
+	env, err := renderEnv(af.Env, data)
+	if err != nil {
+		return err
+	}
+	runKey, err := renderTemplate("run_key", af.RunKey, data)
+	if err != nil {
+		return err
+	}
+	if apply {
+		af.Workdir, af.Env, af.RunKey = workdir, env, runKey
+	}
+
+	for i := range af.Jobs {
+		job := &af.Jobs[i]
+		data["matrix"] = job.matrixValues
+
+		command, err := renderTemplate("command", job.Command, data)
+		if err != nil {
+			return fmt.Errorf("job %q: %w", job.Name, err)
+		}
+		queue, err := renderTemplate("queue", job.Queue, data)
+		if err != nil {
+			return fmt.Errorf("job %q: %w", job.Name, err)
+		}
+		workdir, err := renderTemplate("workdir", job.Workdir, data)
+		if err != nil {
+			return fmt.Errorf("job %q: %w", job.Name, err)
+		}
+		env, err := renderEnv(job.Env, data)
+		if err != nil {
+			return fmt.Errorf("job %q: %w", job.Name, err)
+		}
+		schedule, err := renderTemplate("schedule", job.Schedule, data)
+		if err != nil {
+			return fmt.Errorf("job %q: %w", job.Name, err)
+		}
+		var requires []string
+		for _, r := range job.Requires {
+			rendered, err := renderTemplate("requires", r, data)
+			if err != nil {
+				return fmt.Errorf("job %q: %w", job.Name, err)
+			}
+			requires = append(requires, rendered)
+		}
+		if err := ValidateRequirements(requires); err != nil {
+			return fmt.Errorf("job %q: %w", job.Name, err)
+		}
+
+		// Schedules are checked once rendered, as they can use variables
+		if schedule != "" {
+			loc, err := LoadScheduleLocation(job.Timezone)
+			if err != nil {
+				return fmt.Errorf("job %q: %w", job.Name, err)
+			}
+			if _, err := ParseScheduleTime(schedule, loc, time.Now()); err != nil {
+				return fmt.Errorf("job %q: %w", job.Name, err)
+			}
+		}
+
+		if apply {
+			job.Command, job.Queue, job.Workdir, job.Env = command, queue, workdir, env
+			job.Schedule, job.Requires = schedule, requires
+			if job.Queue == "" {
+				job.Queue = "default"
+			}
+		}
+	}
+	return nil
+}
+
+// renderEnv expands the templates in environment variable values
+func renderEnv(env map[string]string, data map[string]any) (map[string]string, error) {
+	if env == nil {
+		return nil, nil
+	}
+	rendered := make(map[string]string, len(env))
+	for key, value := range env {
+		var err error
+		rendered[key], err = renderTemplate("env "+key, value, data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rendered, nil
+}
+
+// renderTemplate expands a template field. Referencing a variable that is
+// not set is an error.
+func renderTemplate(field, text string, data map[string]any) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	tmpl, err := template.New(field).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid template in %s: %w", field, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		// Turn text/template's "map has no entry for key" into something
+		// that says what to do about it
+		if _, key, found := strings.Cut(err.Error(), "map has no entry for key "); found {
+			if strings.Contains(err.Error(), "<.matrix.") {
+				return "", fmt.Errorf("undefined matrix axis %s in %s", key, field)
+			}
+			return "", fmt.Errorf("undefined variable %s in %s (set it in vars: or with --var)", key, field)
+		}
+		return "", fmt.Errorf("failed to render %s: %w", field, err)
+	}
+	return buf.String(), nil
+}
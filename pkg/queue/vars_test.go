@@ -0,0 +1,80 @@
+package queue
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyFileRender(t *testing.T) {
+	af, err := ParseApplyFileBytes([]byte(`
+vars:
+  env: staging
+env:
+  STAGE: "{{ .vars.env }}"
+jobs:
+  - name: extract
+    command: "extract --date={{ .vars.date }}"
+    queue: "etl-{{ .vars.env }}"
+  - name: list
+    command: >-
+      docker ps --format '{{ "{{" }}.Names}}'
+`))
+	require.NoError(t, err)
+
+	// --var overrides the vars block
+	af.SetVars(map[string]string{"date": "2025-03-01", "env": "prod"})
+	require.NoError(t, af.Validate())
+	require.NoError(t, af.Render())
+
+	assert.Equal(t, "extract --date=2025-03-01", af.Jobs[0].Command)
+	assert.Equal(t, "etl-prod", af.Jobs[0].Queue)
+	assert.Equal(t, map[string]string{"STAGE": "prod"}, af.Jobs[0].Env)
+	assert.Equal(t, "docker ps --format '{{.Names}}'", af.Jobs[1].Command)
+}
+
+func TestValidate_UndefinedVariable(t *testing.T) {
+	af, err := ParseApplyFileBytes([]byte(`
+jobs:
+  - name: extract
+    command: "extract --date={{ .vars.date }}"
+`))
+	require.NoError(t, err)
+	err = af.Validate()
+	assert.EqualError(t, err, `job "extract": undefined variable "date" in command (set it in vars: or with --var)`)
+}
+
+func TestParseVarAssignments(t *testing.T) {
+	vars, err := ParseVarAssignments([]string{"date=2025-03-01", "query=a=b"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"date": "2025-03-01", "query": "a=b"}, vars)
+
+	_, err = ParseVarAssignments([]string{"date"})
+	assert.Error(t, err)
+}
+
+func TestParseVarFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prod.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("env: prod\nshards: 4\n"), 0o644))
+
+	vars, err := ParseVarFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"env": "prod", "shards": "4"}, vars)
+}
+
+func TestRender_RunKey(t *testing.T) {
+	af, err := ParseApplyFileBytes([]byte(`
+run_key: "nightly-{{ .vars.date }}"
+jobs:
+  - name: extract
+    command: "extract"
+`))
+	require.NoError(t, err)
+	af.SetVars(map[string]string{"date": "2025-03-01"})
+	require.NoError(t, af.Validate())
+	require.NoError(t, af.Render())
+	assert.Equal(t, "nightly-2025-03-01", af.RunKey)
+}
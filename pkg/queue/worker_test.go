@@ -0,0 +1,85 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBashWorkerTimeout(t *testing.T) {
+	w := &BashWorker{
+		defaultTimeout: time.Hour,
+		queueTimeouts:  map[string]time.Duration{"ci": 30 * time.Minute},
+	}
+	newJob := func(queueName string, timeoutSeconds int) *river.Job[BashJobArgs] {
+		return &river.Job[BashJobArgs]{
+			JobRow: &rivertype.JobRow{Queue: queueName},
+			Args:   BashJobArgs{Command: "true", TimeoutSeconds: timeoutSeconds},
+		}
+	}
+
+	assert.Equal(t, 10*time.Second, w.runTimeout(newJob("ci", 10)))
+	assert.Equal(t, 30*time.Minute, w.runTimeout(newJob("ci", 0)))
+	assert.Equal(t, time.Hour, w.runTimeout(newJob("default", 0)))
+
+	// No timeout anywhere means no deadline at all
+	assert.Equal(t, time.Duration(-1), (&BashWorker{}).runTimeout(newJob("default", 0)))
+
+	// River never times jobs out itself
+	assert.Equal(t, time.Duration(-1), w.Timeout(newJob("ci", 10)))
+}
+
+func TestBashWorker_TimeoutStartsWithCommand(t *testing.T) {
+	// A job that waits for a slot longer than its timeout still runs
+	w := &BashWorker{slots: make(chan struct{}, 1)}
+	w.slots <- struct{}{}
+	time.AfterFunc(1500*time.Millisecond, func() { <-w.slots })
+	err := w.Work(context.Background(), &river.Job[BashJobArgs]{
+		JobRow: &rivertype.JobRow{ID: 1, Attempt: 1},
+		Args:   BashJobArgs{Command: "true", TimeoutSeconds: 1},
+	})
+	require.NoError(t, err)
+
+	// Its command is still killed once the timeout has passed
+	err = w.Work(context.Background(), &river.Job[BashJobArgs]{
+		JobRow: &rivertype.JobRow{ID: 2, Attempt: 1},
+		Args:   BashJobArgs{Command: "sleep 5", TimeoutSeconds: 1},
+	})
+	var cancel *rivertype.JobCancelError
+	require.ErrorAs(t, err, &cancel)
+	assert.Contains(t, err.Error(), "job timed out after 1s")
+}
+
+func TestBashWorker_InterruptedJobIsRequeued(t *testing.T) {
+	// A job whose context is cancelled by the worker stopping, rather than
+	// by "qq job rm --force" or its timeout, goes back to the queue
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	w := &BashWorker{}
+	err := w.Work(ctx, &river.Job[BashJobArgs]{
+		JobRow: &rivertype.JobRow{ID: 1, Attempt: 1},
+		Args:   BashJobArgs{Command: "sleep 5"},
+	})
+	var snooze *rivertype.JobSnoozeError
+	require.ErrorAs(t, err, &snooze)
+	assert.Zero(t, snooze.Duration)
+}
+
+func TestBashWorker_UnmatchedLabels(t *testing.T) {
+	// A job this worker's labels don't satisfy goes back to be fetched
+	// from its route
+	w := &BashWorker{labels: map[string]string{"os": "linux"}}
+	err := w.Work(context.Background(), &river.Job[BashJobArgs]{
+		JobRow: &rivertype.JobRow{ID: 1, Attempt: 1},
+		Args:   BashJobArgs{Command: "nvidia-smi", Requires: []string{"gpu"}},
+	})
+	var snooze *rivertype.JobSnoozeError
+	require.ErrorAs(t, err, &snooze)
+	assert.Zero(t, snooze.Duration)
+}
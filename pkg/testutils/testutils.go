@@ -5,6 +5,8 @@ import (
 	"context"
 	"fmt"
 	"os/exec"
+	"path/filepath"
+	"runtime"
 	"testing"
 	"time"
 
@@ -73,4 +75,34 @@ func SetupTestDatabase(t *testing.T) (string, func()) {
 	}
 	
 	return dbURL, cleanup
-}
\ No newline at end of file
+}
+// SetupInitializedDatabase starts a PostgreSQL container, creates the qq
+// schema in it with "qq init" and returns a pool connected to it. The
+// cleanup function closes the pool and stops the container.
+func SetupInitializedDatabase(t *testing.T) (*pgxpool.Pool, func()) {
+	t.Helper()
+
+	dbURL, stop := SetupTestDatabase(t)
+
+	// Run qq init from the project root, two levels above this file
+	_, file, _, _ := runtime.Caller(0)
+	initCmd := exec.Command("go", "run", ".", "init", "--db-url", dbURL)
+	initCmd.Dir = filepath.Join(filepath.Dir(file), "..", "..")
+	output, err := initCmd.CombinedOutput()
+	if err != nil {
+		stop()
+	}
+	require.NoError(t, err, "Failed to initialize database: %s", output)
+
+	pool, err := pgxpool.New(context.Background(), dbURL)
+	if err != nil {
+		stop()
+	}
+	require.NoError(t, err, "Failed to connect to test database")
+
+	cleanup := func() {
+		pool.Close()
+		stop()
+	}
+	return pool, cleanup
+}